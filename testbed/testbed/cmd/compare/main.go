@@ -0,0 +1,72 @@
+// Command compare compares the metrics of a candidate with a baseline, e.g.
+// the results of an RFC composition with those of its baseline.toml, and
+// writes a report flagging the significant regressions. For example:
+//
+//	go run ./cmd/compare -baseline results/baseline -candidate results/rfc -o report.md
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/protocol/beyond-bitswap/testbed/testbed/results"
+)
+
+func main() {
+	baseline := flag.String("baseline", "", "directory with the results of the baseline")
+	candidate := flag.String("candidate", "", "directory with the results of the candidate")
+	metrics := flag.String("metrics", strings.Join(results.DefaultCompareMetrics, ","), "comma-separated list of metrics to compare (higher is worse)")
+	confidence := flag.Float64("confidence", 0.95, "confidence level of the intervals and tests")
+	resamples := flag.Int("resamples", 10000, "bootstrap resamples")
+	seed := flag.Int64("seed", 0, "seed of the bootstrap")
+	threshold := flag.Float64("threshold", 0, "percentage change of the mean below which changes are not flagged")
+	format := flag.String("format", "markdown", "output format (markdown, html)")
+	out := flag.String("o", "", "output file (stdout if empty)")
+	flag.Parse()
+
+	opts := results.CompareOptions{
+		Metrics:    strings.Split(*metrics, ","),
+		Confidence: *confidence,
+		Resamples:  *resamples,
+		Seed:       *seed,
+		MinChange:  *threshold / 100,
+	}
+	if err := run(*baseline, *candidate, *format, *out, opts); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(baseline, candidate, format, out string, opts results.CompareOptions) error {
+	if baseline == "" || candidate == "" {
+		return fmt.Errorf("both -baseline and -candidate are required")
+	}
+	if opts.Confidence <= 0 || opts.Confidence >= 1 {
+		return fmt.Errorf("confidence must be between 0 and 1, got %g", opts.Confidence)
+	}
+	base, err := results.ReadDir(baseline)
+	if err != nil {
+		return err
+	}
+	cand, err := results.ReadDir(candidate)
+	if err != nil {
+		return err
+	}
+	comps := results.Compare(base, cand, opts)
+	if len(comps) == 0 {
+		return fmt.Errorf("no matching permutations in %s and %s", baseline, candidate)
+	}
+
+	w := os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return results.WriteReport(w, format, comps, opts)
+}
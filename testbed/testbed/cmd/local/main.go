@@ -0,0 +1,55 @@
+// Command local runs the transfer test case in one process, without
+// Testground. For example:
+//
+//	go run ./cmd/local -instances 4 -param node_type=bitswap -param leech_count=2
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/protocol/beyond-bitswap/testbed/testbed/local"
+)
+
+// paramsFlag collects repeated key=value parameters.
+type paramsFlag map[string]string
+
+func (p paramsFlag) String() string {
+	var kvs []string
+	for k, v := range p {
+		kvs = append(kvs, k+"="+v)
+	}
+	return strings.Join(kvs, ",")
+}
+
+func (p paramsFlag) Set(value string) error {
+	kv := strings.SplitN(value, "=", 2)
+	if len(kv) != 2 {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	p[kv[0]] = kv[1]
+	return nil
+}
+
+func main() {
+	params := paramsFlag{}
+	cfg := local.Config{TestCase: "transfer"}
+	flag.IntVar(&cfg.Instances, "instances", 2, "number of instances")
+	flag.Var(params, "param", "test parameter as key=value, overriding the manifest (repeatable)")
+	flag.StringVar(&cfg.Manifest, "manifest", "manifest.toml", "manifest with the default parameters")
+	flag.StringVar(&cfg.OutputDir, "outputs", "local-outputs", "directory of the outputs of the instances")
+	timeout := flag.Duration("timeout", 10*time.Minute, "timeout of the run")
+	flag.Parse()
+	cfg.Params = params
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	if err := local.Run(ctx, cfg); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,46 @@
+// Command results aggregates the metrics of the results.out files under a
+// directory by permutation, node type and metric. For example:
+//
+//	go run ./cmd/results -dir scripts/results -format csv -o results.csv
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/protocol/beyond-bitswap/testbed/testbed/results"
+)
+
+func main() {
+	dir := flag.String("dir", "scripts/results", "directory with the results of the instances")
+	format := flag.String("format", "csv", "output format (csv, json)")
+	out := flag.String("o", "", "output file (stdout if empty)")
+	flag.Parse()
+
+	if err := run(*dir, *format, *out); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, format, out string) error {
+	records, err := results.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return fmt.Errorf("no results in %s", dir)
+	}
+
+	w := os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+	return results.Write(w, format, results.AggregateRecords(records))
+}
@@ -7,6 +7,7 @@ require (
 	github.com/dgraph-io/badger/v2 v2.2007.2
 	github.com/hannahhoward/all-selector v0.2.0
 	github.com/ipfs/go-bitswap v0.2.20
+	github.com/ipfs/go-block-format v0.0.2
 	github.com/ipfs/go-blockservice v0.1.3
 	github.com/ipfs/go-cid v0.0.7
 	github.com/ipfs/go-datastore v0.4.5
@@ -0,0 +1,65 @@
+package local
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	testcaseRe = regexp.MustCompile(`^\s*name\s*=\s*"([^"]*)"`)
+	paramRe    = regexp.MustCompile(`^\s*(\w+)\s*=\s*\{.*\bdefault\s*=\s*("(?:[^"\\]|\\.)*"|[^,}\s]+)`)
+)
+
+// readDefaults returns the default values of the parameters of the test case
+// in the manifest, as Testground passes them to the instances. It only
+// understands the one-line parameter tables used by the manifest of the plan.
+func readDefaults(path string, testcase string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	params := make(map[string]string)
+	found, inParams := false, false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "[[testcases]]":
+			if found {
+				return params, nil
+			}
+			inParams = false
+		case strings.HasPrefix(line, "["):
+			inParams = found && line == "[testcases.params]"
+		case !found:
+			if m := testcaseRe.FindStringSubmatch(line); m != nil {
+				found = m[1] == testcase
+			}
+		case inParams:
+			m := paramRe.FindStringSubmatch(line)
+			if m == nil {
+				continue
+			}
+			value := m[2]
+			if strings.HasPrefix(value, `"`) {
+				if value, err = strconv.Unquote(value); err != nil {
+					return nil, fmt.Errorf("default of %s: %w", m[1], err)
+				}
+			}
+			params[m[1]] = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("no test case %q in %s", testcase, path)
+	}
+	return params, nil
+}
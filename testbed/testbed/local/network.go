@@ -0,0 +1,161 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"net"
+	gosync "sync"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
+	mocknet "github.com/libp2p/go-libp2p/p2p/net/mock"
+	ma "github.com/multiformats/go-multiaddr"
+	manet "github.com/multiformats/go-multiaddr/net"
+	"github.com/testground/sdk-go/network"
+	"github.com/testground/sdk-go/sync"
+)
+
+// Network is a mock network shared by all the instances of a local run. Every
+// instance gets a fake data network IP, used to shape the links to it.
+//
+// Links of the mock network are symmetric and only simulate latency and
+// bandwidth: the last instance shaping a link sets both directions, and
+// jitter, loss, corruption, reordering and duplication are ignored. Links
+// dropping all traffic are removed until they are shaped again.
+type Network struct {
+	mn        mocknet.Mocknet
+	sync      *syncClient
+	instances int
+
+	lk    gosync.Mutex
+	peers map[string]peer.ID
+	ready chan struct{}
+}
+
+func newNetwork(ctx context.Context, sync *syncClient, instances int) *Network {
+	return &Network{
+		mn:        mocknet.New(ctx),
+		sync:      sync,
+		instances: instances,
+		peers:     make(map[string]peer.ID),
+		ready:     make(chan struct{}),
+	}
+}
+
+// newHost adds a host to the mock network, linked to every other host. Its
+// data network IP is the one of the first address. libp2p options don't apply
+// to mock hosts, so bandwidth reporters never count the traffic of their
+// streams.
+func (n *Network) newHost(ctx context.Context, privKey crypto.PrivKey, addrs []ma.Multiaddr, _ ...libp2p.Option) (host.Host, error) {
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no address for the host")
+	}
+	ip, err := manet.ToIP(addrs[0])
+	if err != nil {
+		return nil, err
+	}
+	h, err := n.mn.AddPeer(privKey, addrs[0])
+	if err != nil {
+		return nil, err
+	}
+
+	n.lk.Lock()
+	defer n.lk.Unlock()
+	for _, p := range n.peers {
+		if _, err := n.mn.LinkPeers(h.ID(), p); err != nil {
+			return nil, err
+		}
+	}
+	n.peers[ip.String()] = h.ID()
+	if len(n.peers) == n.instances {
+		close(n.ready)
+	}
+	return h, nil
+}
+
+// netClient shapes the links of an instance in the mock network.
+type netClient struct {
+	n  *Network
+	ip net.IP
+}
+
+func (c *netClient) WaitNetworkInitialized(ctx context.Context) error {
+	return nil
+}
+
+func (c *netClient) MustGetDataNetworkIP() net.IP {
+	return c.ip
+}
+
+// ConfigureNetwork shapes the links to every other instance with the default
+// link shape or the one of the rule matching its IP. It waits for all the
+// hosts to be created, and then for the callback target like the sidecar.
+func (c *netClient) ConfigureNetwork(ctx context.Context, cfg *network.Config) error {
+	select {
+	case <-c.n.ready:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	c.n.lk.Lock()
+	self, ok := c.n.peers[c.ip.String()]
+	if !ok {
+		c.n.lk.Unlock()
+		return fmt.Errorf("no host with IP %s", c.ip)
+	}
+	for ipStr, p := range c.n.peers {
+		if p == self {
+			continue
+		}
+		shape := cfg.Default
+		ip := net.ParseIP(ipStr)
+		for _, r := range cfg.Rules {
+			if r.Subnet.Contains(ip) {
+				shape = r.LinkShape
+			}
+		}
+		if err := c.n.shape(self, p, shape); err != nil {
+			c.n.lk.Unlock()
+			return err
+		}
+	}
+	c.n.lk.Unlock()
+
+	if cfg.CallbackState == "" {
+		return nil
+	}
+	target := cfg.CallbackTarget
+	if target == 0 {
+		target = c.n.instances
+	}
+	_, err := c.n.sync.SignalAndWait(ctx, sync.State(cfg.CallbackState), target)
+	return err
+}
+
+// shape sets the shape of the link between the peers. Must be called with the
+// lock held.
+func (n *Network) shape(a, b peer.ID, shape network.LinkShape) error {
+	links := n.mn.LinksBetweenPeers(a, b)
+	if shape.Filter == network.Drop || shape.Filter == network.Reject {
+		if len(links) == 0 {
+			return nil
+		}
+		if err := n.mn.UnlinkPeers(a, b); err != nil {
+			return err
+		}
+		return n.mn.DisconnectPeers(a, b)
+	}
+	if len(links) == 0 {
+		l, err := n.mn.LinkPeers(a, b)
+		if err != nil {
+			return err
+		}
+		links = append(links, l)
+	}
+	for _, l := range links {
+		l.SetOptions(mocknet.LinkOptions{Latency: shape.Latency, Bandwidth: float64(shape.Bandwidth)})
+	}
+	return nil
+}
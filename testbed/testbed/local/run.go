@@ -0,0 +1,119 @@
+// Package local runs the test cases of the plan without Testground: all the
+// instances run in one process and talk over a libp2p mock network, with an
+// in-memory sync service.
+package local
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	gosync "sync"
+	"time"
+
+	"github.com/testground/sdk-go/runtime"
+
+	"github.com/protocol/beyond-bitswap/testbed/testbed/test"
+)
+
+// Config of a local run.
+type Config struct {
+	// TestCase to run. Only the transfer test case is supported.
+	TestCase  string
+	Instances int
+	// Params override the defaults of the manifest.
+	Params   map[string]string
+	Manifest string
+	// OutputDir gets the outputs of every instance, in a directory named
+	// after its index.
+	OutputDir string
+}
+
+// Node types creating their own host or listening on the data network, which
+// the mock network can't carry.
+var unsupportedNodes = map[string]bool{
+	"ipfs": true,
+	"http": true,
+}
+
+// Run runs all the instances of the test case and returns once they are done.
+// It fails with the first error returned by an instance.
+func Run(ctx context.Context, cfg Config) error {
+	if cfg.TestCase != "transfer" {
+		return fmt.Errorf("unsupported test case: %s", cfg.TestCase)
+	}
+	if cfg.Instances < 2 {
+		return fmt.Errorf("at least 2 instances are needed, got %d", cfg.Instances)
+	}
+	params, err := readDefaults(cfg.Manifest, cfg.TestCase)
+	if err != nil {
+		return err
+	}
+	for k, v := range cfg.Params {
+		params[k] = v
+	}
+	if unsupportedNodes[params["node_type"]] {
+		return fmt.Errorf("node type %s is not supported in local runs", params["node_type"])
+	}
+	if enabled, _ := strconv.ParseBool(params["enable_tcp"]); enabled {
+		return fmt.Errorf("enable_tcp is not supported in local runs")
+	}
+
+	sync := newSyncClient()
+	nw := newNetwork(ctx, sync, cfg.Instances)
+	runID := strconv.FormatInt(time.Now().Unix(), 10)
+	start := time.Now()
+
+	var wg gosync.WaitGroup
+	errs := make([]error, cfg.Instances)
+	for i := 0; i < cfg.Instances; i++ {
+		outputs := filepath.Join(cfg.OutputDir, strconv.Itoa(i))
+		if err := os.MkdirAll(outputs, 0755); err != nil {
+			return err
+		}
+		runenv := runtime.NewRunEnv(runtime.RunParams{
+			TestPlan:               "testbed",
+			TestCase:               cfg.TestCase,
+			TestRun:                runID,
+			TestOutputsPath:        outputs,
+			TestInstanceCount:      cfg.Instances,
+			TestInstanceParams:     params,
+			TestGroupInstanceCount: cfg.Instances,
+			TestSidecar:            true,
+			TestStartTime:          start,
+		})
+		env := &test.Env{
+			Sync:    sync,
+			Network: &netClient{n: nw, ip: instanceIP(i)},
+			NewHost: nw.newHost,
+		}
+
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			defer runenv.Close()
+			runenv.RecordStart()
+			if errs[i] = test.RunTransfer(runenv, env); errs[i] != nil {
+				runenv.RecordFailure(errs[i])
+			} else {
+				runenv.RecordSuccess()
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return fmt.Errorf("instance %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// instanceIP returns the data network IP of the instance, in 10.0.0.0/16.
+func instanceIP(i int) net.IP {
+	i++
+	return net.IPv4(10, 0, byte(i>>8), byte(i))
+}
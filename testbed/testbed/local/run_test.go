@@ -0,0 +1,81 @@
+package local
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/protocol/beyond-bitswap/testbed/testbed/results"
+)
+
+func TestRunBitswap(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping local run in short mode")
+	}
+	dir, err := ioutil.TempDir("", "local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+	cfg := Config{
+		TestCase:  "transfer",
+		Instances: 3,
+		Manifest:  "../manifest.toml",
+		OutputDir: dir,
+		Params: map[string]string{
+			"node_type":        "bitswap",
+			"leech_count":      "2",
+			"file_size":        "262144",
+			"latency_ms":       "1",
+			"timeout_secs":     "90",
+			"run_timeout_secs": "60",
+		},
+	}
+	if err := Run(ctx, cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := results.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var verified int
+	for _, r := range records {
+		if r.Name != "verify_ok" || r.NodeType != "Leech" {
+			continue
+		}
+		if r.Value != 1 {
+			t.Errorf("leech %d failed to verify the fetched file", r.NodeTypeIndex)
+		}
+		verified++
+	}
+	if verified != 2 {
+		t.Fatalf("got %d verify_ok records from leeches, expected 2", verified)
+	}
+}
+
+func TestRunUnsupported(t *testing.T) {
+	cases := []struct {
+		name string
+		cfg  Config
+	}{
+		{"test case", Config{TestCase: "other", Instances: 2, Manifest: "../manifest.toml"}},
+		{"instances", Config{TestCase: "transfer", Instances: 1, Manifest: "../manifest.toml"}},
+		{"node type", Config{TestCase: "transfer", Instances: 2, Manifest: "../manifest.toml",
+			Params: map[string]string{"node_type": "http"}}},
+		{"tcp", Config{TestCase: "transfer", Instances: 2, Manifest: "../manifest.toml",
+			Params: map[string]string{"node_type": "bitswap", "enable_tcp": "true"}}},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Run(context.Background(), tt.cfg); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	gosync "sync"
+
+	"github.com/testground/sdk-go/runtime"
+	"github.com/testground/sdk-go/sync"
+)
+
+// syncClient is an in-process sync service shared by all the instances of a
+// local run. Like the Redis-backed client, payloads are sent as JSON and
+// subscriptions replay everything published to the topic before them.
+type syncClient struct {
+	lk       gosync.Mutex
+	states   map[sync.State]int64
+	barriers map[sync.State][]*barrier
+	topics   map[string]*topicLog
+}
+
+type barrier struct {
+	target int64
+	done   chan struct{}
+}
+
+// topicLog holds the payloads published to a topic. updated is closed and
+// replaced on every publication.
+type topicLog struct {
+	payloads [][]byte
+	updated  chan struct{}
+}
+
+var _ sync.Client = &syncClient{}
+
+func newSyncClient() *syncClient {
+	return &syncClient{
+		states:   make(map[sync.State]int64),
+		barriers: make(map[sync.State][]*barrier),
+		topics:   make(map[string]*topicLog),
+	}
+}
+
+// topic returns the log of the topic. Must be called with the lock held.
+func (c *syncClient) topic(topic *sync.Topic) *topicLog {
+	// Topic names are not exported, but keys are unique.
+	key := topic.Key(&runtime.RunParams{})
+	t, ok := c.topics[key]
+	if !ok {
+		t = &topicLog{updated: make(chan struct{})}
+		c.topics[key] = t
+	}
+	return t
+}
+
+func (c *syncClient) Publish(_ context.Context, topic *sync.Topic, payload interface{}) (int64, error) {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to encode payload: %w", err)
+	}
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	t := c.topic(topic)
+	t.payloads = append(t.payloads, raw)
+	close(t.updated)
+	t.updated = make(chan struct{})
+	return int64(len(t.payloads)), nil
+}
+
+// Subscribe sends every payload of the topic to ch, a channel of the type of
+// the topic, until the context is done. Then ch is closed.
+func (c *syncClient) Subscribe(ctx context.Context, topic *sync.Topic, ch interface{}) (*sync.Subscription, error) {
+	chV := reflect.ValueOf(ch)
+	if chV.Kind() != reflect.Chan {
+		return nil, fmt.Errorf("expected a channel, got %T", ch)
+	}
+	typ := chV.Type().Elem()
+
+	go func() {
+		defer chV.Close()
+		for next := 0; ; next++ {
+			c.lk.Lock()
+			t := c.topic(topic)
+			for next >= len(t.payloads) {
+				updated := t.updated
+				c.lk.Unlock()
+				select {
+				case <-updated:
+				case <-ctx.Done():
+					return
+				}
+				c.lk.Lock()
+			}
+			raw := t.payloads[next]
+			c.lk.Unlock()
+
+			v, err := decodePayload(raw, typ)
+			if err != nil {
+				return
+			}
+			chosen, _, _ := reflect.Select([]reflect.SelectCase{
+				{Dir: reflect.SelectSend, Chan: chV, Send: v},
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+			})
+			if chosen == 1 {
+				return
+			}
+		}
+	}()
+	return &sync.Subscription{}, nil
+}
+
+// decodePayload decodes the payload as a value of type typ, which may be a pointer.
+func decodePayload(raw []byte, typ reflect.Type) (reflect.Value, error) {
+	elem := typ
+	if typ.Kind() == reflect.Ptr {
+		elem = typ.Elem()
+	}
+	v := reflect.New(elem)
+	if err := json.Unmarshal(raw, v.Interface()); err != nil {
+		return reflect.Value{}, err
+	}
+	if typ.Kind() == reflect.Ptr {
+		return v, nil
+	}
+	return v.Elem(), nil
+}
+
+func (c *syncClient) PublishAndWait(ctx context.Context, topic *sync.Topic, payload interface{}, state sync.State, target int) (int64, error) {
+	seq, err := c.Publish(ctx, topic, payload)
+	if err != nil {
+		return 0, err
+	}
+	_, err = c.SignalAndWait(ctx, state, target)
+	return seq, err
+}
+
+func (c *syncClient) PublishSubscribe(ctx context.Context, topic *sync.Topic, payload interface{}, ch interface{}) (int64, *sync.Subscription, error) {
+	seq, err := c.Publish(ctx, topic, payload)
+	if err != nil {
+		return 0, nil, err
+	}
+	sub, err := c.Subscribe(ctx, topic, ch)
+	return seq, sub, err
+}
+
+// Barrier returns a barrier whose channel receives nil once the state has
+// target entries, or the error of the context if it's done before.
+func (c *syncClient) Barrier(ctx context.Context, state sync.State, target int) (*sync.Barrier, error) {
+	b := &barrier{target: int64(target), done: make(chan struct{})}
+	c.lk.Lock()
+	if c.states[state] >= b.target {
+		close(b.done)
+	} else {
+		c.barriers[state] = append(c.barriers[state], b)
+	}
+	c.lk.Unlock()
+
+	out := &sync.Barrier{C: make(chan error, 1)}
+	go func() {
+		defer close(out.C)
+		select {
+		case <-b.done:
+			out.C <- nil
+		case <-ctx.Done():
+			out.C <- ctx.Err()
+		}
+	}()
+	return out, nil
+}
+
+func (c *syncClient) SignalEntry(_ context.Context, state sync.State) (int64, error) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.states[state]++
+	count := c.states[state]
+	var waiting []*barrier
+	for _, b := range c.barriers[state] {
+		if count >= b.target {
+			close(b.done)
+		} else {
+			waiting = append(waiting, b)
+		}
+	}
+	c.barriers[state] = waiting
+	return count, nil
+}
+
+func (c *syncClient) SignalAndWait(ctx context.Context, state sync.State, target int) (int64, error) {
+	seq, err := c.SignalEntry(ctx, state)
+	if err != nil {
+		return 0, err
+	}
+	b, err := c.Barrier(ctx, state, target)
+	if err != nil {
+		return 0, err
+	}
+	return seq, <-b.C
+}
+
+func (c *syncClient) MustBarrier(ctx context.Context, state sync.State, target int) *sync.Barrier {
+	b, err := c.Barrier(ctx, state, target)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func (c *syncClient) MustSignalEntry(ctx context.Context, state sync.State) int64 {
+	seq, err := c.SignalEntry(ctx, state)
+	if err != nil {
+		panic(err)
+	}
+	return seq
+}
+
+func (c *syncClient) MustSubscribe(ctx context.Context, topic *sync.Topic, ch interface{}) *sync.Subscription {
+	sub, err := c.Subscribe(ctx, topic, ch)
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+func (c *syncClient) MustPublish(ctx context.Context, topic *sync.Topic, payload interface{}) int64 {
+	seq, err := c.Publish(ctx, topic, payload)
+	if err != nil {
+		panic(err)
+	}
+	return seq
+}
+
+func (c *syncClient) MustPublishAndWait(ctx context.Context, topic *sync.Topic, payload interface{}, state sync.State, target int) int64 {
+	seq, err := c.PublishAndWait(ctx, topic, payload, state, target)
+	if err != nil {
+		panic(err)
+	}
+	return seq
+}
+
+func (c *syncClient) MustPublishSubscribe(ctx context.Context, topic *sync.Topic, payload interface{}, ch interface{}) (int64, *sync.Subscription) {
+	seq, sub, err := c.PublishSubscribe(ctx, topic, payload, ch)
+	if err != nil {
+		panic(err)
+	}
+	return seq, sub
+}
+
+func (c *syncClient) MustSignalAndWait(ctx context.Context, state sync.State, target int) int64 {
+	seq, err := c.SignalAndWait(ctx, state, target)
+	if err != nil {
+		panic(err)
+	}
+	return seq
+}
+
+func (c *syncClient) SignalEvent(context.Context, *runtime.Event) error {
+	return nil
+}
+
+func (c *syncClient) Close() error {
+	return nil
+}
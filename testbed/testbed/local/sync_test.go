@@ -0,0 +1,117 @@
+package local
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/testground/sdk-go/sync"
+)
+
+type testPayload struct {
+	N int
+}
+
+func TestSyncBarrier(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := newSyncClient()
+	state := sync.State("ready")
+
+	b, err := c.Barrier(ctx, state, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if seq := c.MustSignalEntry(ctx, state); seq != 1 {
+		t.Fatalf("got seq %d, expected 1", seq)
+	}
+	select {
+	case <-b.C:
+		t.Fatal("barrier released before reaching its target")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if seq := c.MustSignalEntry(ctx, state); seq != 2 {
+		t.Fatalf("got seq %d, expected 2", seq)
+	}
+	if err := <-b.C; err != nil {
+		t.Fatal(err)
+	}
+
+	// Barriers on states already reached are released at once.
+	if err := <-c.MustBarrier(ctx, state, 2).C; err != nil {
+		t.Fatal(err)
+	}
+
+	// Barriers not reached fail with the context.
+	bctx, bcancel := context.WithCancel(ctx)
+	b = c.MustBarrier(bctx, state, 3)
+	bcancel()
+	if err := <-b.C; err != context.Canceled {
+		t.Fatalf("got %v, expected %v", err, context.Canceled)
+	}
+}
+
+func TestSyncSignalAndWait(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := newSyncClient()
+	state := sync.State("done")
+
+	const n = 4
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			_, err := c.SignalAndWait(ctx, state, n)
+			errs <- err
+		}()
+	}
+	for i := 0; i < n; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyncTopicReplay(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	c := newSyncClient()
+	topic := sync.NewTopic("payloads", &testPayload{})
+
+	// Payloads published before subscribing are replayed.
+	c.MustPublish(ctx, topic, &testPayload{N: 0})
+	c.MustPublish(ctx, topic, &testPayload{N: 1})
+
+	ptrs := make(chan *testPayload)
+	c.MustSubscribe(ctx, topic, ptrs)
+	values := make(chan testPayload)
+	c.MustSubscribe(ctx, topic, values)
+	c.MustPublish(ctx, topic, &testPayload{N: 2})
+
+	for i := 0; i < 3; i++ {
+		if p := <-ptrs; p.N != i {
+			t.Errorf("got payload %d, expected %d", p.N, i)
+		}
+		if p := <-values; p.N != i {
+			t.Errorf("got payload %d, expected %d", p.N, i)
+		}
+	}
+
+	// Other topics are not mixed up.
+	other := make(chan *testPayload)
+	c.MustSubscribe(ctx, sync.NewTopic("other", &testPayload{}), other)
+	select {
+	case p := <-other:
+		t.Fatalf("got payload %d from an empty topic", p.N)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// Channels are closed once the context is done.
+	cancel()
+	for range ptrs {
+	}
+	for range values {
+	}
+	for range other {
+	}
+}
@@ -0,0 +1,241 @@
+package results
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Summary holds the statistics of a set of values.
+type Summary struct {
+	Count  int     `json:"count"`
+	Mean   float64 `json:"mean"`
+	Median float64 `json:"median"`
+	P95    float64 `json:"p95"`
+	// Stddev is the sample standard deviation.
+	Stddev float64 `json:"stddev"`
+	Min    float64 `json:"min"`
+	Max    float64 `json:"max"`
+}
+
+// Summarize returns the statistics of the values.
+func Summarize(values []float64) Summary {
+	s := Summary{Count: len(values)}
+	if len(values) == 0 {
+		return s
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	var sum float64
+	for _, v := range sorted {
+		sum += v
+	}
+	s.Mean = sum / float64(len(sorted))
+	if len(sorted) > 1 {
+		var sq float64
+		for _, v := range sorted {
+			sq += (v - s.Mean) * (v - s.Mean)
+		}
+		s.Stddev = math.Sqrt(sq / float64(len(sorted)-1))
+	}
+	s.Median = Percentile(sorted, 50)
+	s.P95 = Percentile(sorted, 95)
+	s.Min, s.Max = sorted[0], sorted[len(sorted)-1]
+	return s
+}
+
+// Percentile returns the p-th percentile of the sorted values, interpolating
+// linearly between the closest ranks. Infinite values are supported.
+func Percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return math.NaN()
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lo := int(math.Floor(rank))
+	hi := int(math.Ceil(rank))
+	if sorted[lo] == sorted[hi] || rank == float64(lo) {
+		// Avoids subtracting infinite values.
+		return sorted[lo]
+	}
+	if math.IsInf(sorted[lo], 0) || math.IsInf(sorted[hi], 0) {
+		if rank-float64(lo) < 0.5 {
+			return sorted[lo]
+		}
+		return sorted[hi]
+	}
+	return sorted[lo] + (sorted[hi]-sorted[lo])*(rank-float64(lo))
+}
+
+// Key identifies a metric of a node type in a permutation.
+type Key struct {
+	Permutation
+	// Labels holds the extra labels of the metric (e.g. the bucket of a
+	// histogram or the time of a sample) as sorted key=value pairs separated
+	// by semicolons, so that every series is summarized on its own.
+	Labels   string `json:"labels"`
+	NodeType string `json:"node_type"`
+	Metric   string `json:"metric"`
+}
+
+// keyOf returns the key of the metric of the record.
+func keyOf(r Record) Key {
+	return Key{Permutation: r.Permutation, Labels: canonicalLabels(r.Labels), NodeType: r.NodeType, Metric: r.Name}
+}
+
+// canonicalLabels returns the labels as key=value pairs sorted by key and
+// separated by semicolons.
+func canonicalLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + labels[k]
+	}
+	return strings.Join(pairs, ";")
+}
+
+// fields returns the values of the key, in the order of keyHeader.
+func (k Key) fields() []string {
+	p := k.Permutation
+	return []string{
+		strconv.Itoa(p.Seeds), strconv.Itoa(p.Leeches), strconv.Itoa(p.Passives),
+		p.Transport, strconv.Itoa(p.MaxConnectionRate),
+		strconv.FormatInt(p.LatencyMS, 10), strconv.Itoa(p.BandwidthMB),
+		formatFloat(p.LossPct), formatFloat(p.CorruptPct), formatFloat(p.ReorderPct), formatFloat(p.DuplicatePct),
+		strconv.FormatInt(p.FileSize, 10),
+		p.Layout, p.Chunker, strconv.FormatBool(p.RawLeaves), p.HashFunc, strconv.Itoa(p.MaxLinks), strconv.Itoa(p.CidVersion),
+		k.Labels, k.NodeType, k.Metric,
+	}
+}
+
+var keyHeader = []string{
+	"seeds", "leeches", "passives",
+	"transport", "max_connection_rate",
+	"latency_ms", "bandwidth_mb",
+	"loss_pct", "corrupt_pct", "reorder_pct", "duplicate_pct",
+	"file_size",
+	"layout", "chunker", "raw_leaves", "hash_func", "max_links", "cid_version",
+	"labels", "node_type", "metric",
+}
+
+// less orders keys by their fields, comparing numbers numerically, also
+// within labels.
+func (k Key) less(o Key) bool {
+	a, b := k.fields(), o.fields()
+	for i := range a {
+		if a[i] == b[i] {
+			continue
+		}
+		x, xerr := strconv.ParseFloat(a[i], 64)
+		y, yerr := strconv.ParseFloat(b[i], 64)
+		if xerr == nil && yerr == nil {
+			return x < y
+		}
+		return naturalLess(a[i], b[i])
+	}
+	return false
+}
+
+// naturalLess compares the strings by their runs of digits and non-digits,
+// comparing runs of digits numerically (so that "arrivalMS=8" goes before
+// "arrivalMS=16").
+func naturalLess(a, b string) bool {
+	for a != "" && b != "" {
+		x, restA := nextRun(a)
+		y, restB := nextRun(b)
+		if x != y {
+			xn, xerr := strconv.ParseUint(x, 10, 64)
+			yn, yerr := strconv.ParseUint(y, 10, 64)
+			if xerr == nil && yerr == nil && xn != yn {
+				return xn < yn
+			}
+			return x < y
+		}
+		a, b = restA, restB
+	}
+	return len(a) < len(b)
+}
+
+// nextRun splits the leading run of digits or non-digits of s.
+func nextRun(s string) (string, string) {
+	digit := func(c byte) bool { return c >= '0' && c <= '9' }
+	i := 1
+	for i < len(s) && digit(s[i]) == digit(s[0]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// Aggregate is the summary of a metric of a node type in a permutation, over
+// all the runs and nodes.
+type Aggregate struct {
+	Key
+	Summary
+}
+
+// AggregateRecords groups the records by permutation, labels, node type and
+// metric, and summarizes every group. Aggregates are sorted by key.
+func AggregateRecords(records []Record) []Aggregate {
+	groups := make(map[Key][]float64)
+	for _, r := range records {
+		k := keyOf(r)
+		groups[k] = append(groups[k], r.Value)
+	}
+	aggs := make([]Aggregate, 0, len(groups))
+	for k, values := range groups {
+		aggs = append(aggs, Aggregate{Key: k, Summary: Summarize(values)})
+	}
+	sort.Slice(aggs, func(i, j int) bool { return aggs[i].Key.less(aggs[j].Key) })
+	return aggs
+}
+
+// WriteCSV writes the aggregates as CSV, one per row.
+func WriteCSV(w io.Writer, aggs []Aggregate) error {
+	cw := csv.NewWriter(w)
+	header := append(append([]string(nil), keyHeader...), "count", "mean", "median", "p95", "stddev", "min", "max")
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	for _, a := range aggs {
+		row := append(a.Key.fields(), strconv.Itoa(a.Count),
+			formatFloat(a.Mean), formatFloat(a.Median), formatFloat(a.P95),
+			formatFloat(a.Stddev), formatFloat(a.Min), formatFloat(a.Max))
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WriteJSON writes the aggregates as a JSON array.
+func WriteJSON(w io.Writer, aggs []Aggregate) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(aggs)
+}
+
+// Write writes the aggregates in the format, csv or json.
+func Write(w io.Writer, format string, aggs []Aggregate) error {
+	switch format {
+	case "csv":
+		return WriteCSV(w, aggs)
+	case "json":
+		return WriteJSON(w, aggs)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
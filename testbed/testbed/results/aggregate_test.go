@@ -0,0 +1,109 @@
+package results
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	cases := []struct {
+		values   []float64
+		expected Summary
+	}{
+		{nil, Summary{}},
+		{[]float64{3}, Summary{Count: 1, Mean: 3, Median: 3, P95: 3, Min: 3, Max: 3}},
+		{[]float64{4, 1, 3, 2}, Summary{Count: 4, Mean: 2.5, Median: 2.5, P95: 3.85, Stddev: math.Sqrt(5.0 / 3), Min: 1, Max: 4}},
+		{[]float64{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20, 21},
+			Summary{Count: 21, Mean: 11, Median: 11, P95: 20, Stddev: math.Sqrt(38.5), Min: 1, Max: 21}},
+	}
+	for _, tt := range cases {
+		s := Summarize(tt.values)
+		if s.Count != tt.expected.Count || !near(s.Mean, tt.expected.Mean) || !near(s.Median, tt.expected.Median) ||
+			!near(s.P95, tt.expected.P95) || !near(s.Stddev, tt.expected.Stddev) || s.Min != tt.expected.Min || s.Max != tt.expected.Max {
+			t.Errorf("Summarize(%v) = %+v, expected %+v", tt.values, s, tt.expected)
+		}
+	}
+}
+
+func near(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestAggregateRecords(t *testing.T) {
+	bitswap := Permutation{Seeds: 1, Leeches: 1, Transport: "bitswap", LatencyMS: 100}
+	graphsync := Permutation{Seeds: 1, Leeches: 1, Transport: "graphsync", LatencyMS: 100}
+	fast := bitswap
+	fast.LatencyMS = 5
+	records := []Record{
+		{Permutation: graphsync, Run: 1, NodeType: "Leech", Name: "time_to_fetch", Value: 5},
+		{Permutation: bitswap, Run: 1, NodeType: "Leech", Name: "time_to_fetch", Value: 10},
+		{Permutation: bitswap, Run: 2, NodeType: "Leech", Name: "time_to_fetch", Value: 20},
+		{Permutation: bitswap, Run: 1, NodeType: "Seed", Name: "data_sent", Value: 100},
+		{Permutation: fast, Run: 1, NodeType: "Leech", Name: "time_to_fetch", Value: 1},
+		// Every series of labeled metrics is summarized on its own.
+		{Permutation: bitswap, Run: 1, NodeType: "Leech", Labels: map[string]string{"arrivalMS": "16"}, Name: "block_arrivals", Value: 3},
+		{Permutation: bitswap, Run: 1, NodeType: "Leech", Labels: map[string]string{"arrivalMS": "8"}, Name: "block_arrivals", Value: 1},
+		{Permutation: bitswap, Run: 2, NodeType: "Leech", Labels: map[string]string{"arrivalMS": "8"}, Name: "block_arrivals", Value: 2},
+	}
+	aggs := AggregateRecords(records)
+	expected := []struct {
+		key   Key
+		count int
+		mean  float64
+	}{
+		{Key{Permutation: fast, NodeType: "Leech", Metric: "time_to_fetch"}, 1, 1},
+		{Key{Permutation: bitswap, NodeType: "Leech", Metric: "time_to_fetch"}, 2, 15},
+		{Key{Permutation: bitswap, NodeType: "Seed", Metric: "data_sent"}, 1, 100},
+		{Key{Permutation: bitswap, Labels: "arrivalMS=8", NodeType: "Leech", Metric: "block_arrivals"}, 2, 1.5},
+		{Key{Permutation: bitswap, Labels: "arrivalMS=16", NodeType: "Leech", Metric: "block_arrivals"}, 1, 3},
+		{Key{Permutation: graphsync, NodeType: "Leech", Metric: "time_to_fetch"}, 1, 5},
+	}
+	if len(aggs) != len(expected) {
+		t.Fatalf("%d aggregates, expected %d", len(aggs), len(expected))
+	}
+	for i, e := range expected {
+		if aggs[i].Key != e.key || aggs[i].Count != e.count || aggs[i].Mean != e.mean {
+			t.Errorf("aggregate %d is %+v, expected %+v with count %d and mean %g", i, aggs[i], e.key, e.count, e.mean)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Write(&buf, "csv", aggs); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(aggs)+1 || len(rows[0]) != len(keyHeader)+7 {
+		t.Errorf("CSV has %d rows of %d columns", len(rows), len(rows[0]))
+	}
+
+	buf.Reset()
+	if err := Write(&buf, "json", aggs); err != nil {
+		t.Fatal(err)
+	}
+	var decoded []map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded[1]["transport"] != "bitswap" || decoded[1]["metric"] != "time_to_fetch" || decoded[1]["mean"] != 15.0 {
+		t.Errorf("unexpected JSON aggregate %v", decoded[1])
+	}
+
+	if err := Write(&buf, "xml", aggs); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestCanonicalLabels(t *testing.T) {
+	if l := canonicalLabels(nil); l != "" {
+		t.Errorf("canonicalLabels(nil) = %q, expected no labels", l)
+	}
+	if l := canonicalLabels(map[string]string{"request": "2", "item": "7"}); l != "item=7;request=2" {
+		t.Errorf("canonicalLabels = %q, expected item=7;request=2", l)
+	}
+}
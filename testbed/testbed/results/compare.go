@@ -0,0 +1,201 @@
+package results
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// DefaultCompareMetrics are the metrics compared by default, all of them
+// lower is better.
+var DefaultCompareMetrics = []string{"time_to_fetch", "dup_blks_rcvd", "data_sent"}
+
+// CompareOptions configures the comparison of a candidate with a baseline.
+type CompareOptions struct {
+	// Metrics to compare. Higher values are regressions.
+	Metrics []string
+	// Confidence level of the intervals and significance of the tests,
+	// e.g. 0.95.
+	Confidence float64
+	// Resamples of the bootstrap.
+	Resamples int
+	// Seed of the bootstrap.
+	Seed int64
+	// MinChange is the relative change of the mean below which significant
+	// changes are not flagged, e.g. 0.05 for 5%.
+	MinChange float64
+}
+
+// Comparison is the change of a metric of a node type in a permutation, from
+// the baseline to the candidate.
+type Comparison struct {
+	Key
+	Baseline  Summary `json:"baseline"`
+	Candidate Summary `json:"candidate"`
+	// Diff is the absolute change of the mean.
+	Diff float64 `json:"diff"`
+	// Change is the relative change of the mean (0.1 is 10% higher). It is
+	// infinite if the mean of the baseline is 0 and the candidate's isn't.
+	Change float64 `json:"change"`
+	// CILow and CIHigh bound the bootstrap confidence interval of Change.
+	// They are NaN if the mean of the baseline is 0.
+	CILow  float64 `json:"ci_low"`
+	CIHigh float64 `json:"ci_high"`
+	// PValue is the two-sided p-value of the Mann-Whitney U test.
+	PValue float64 `json:"p_value"`
+	// Significant is set when the confidence interval excludes no change and
+	// the Mann-Whitney test rejects that both samples have the same
+	// distribution. If the mean of the baseline is 0 (e.g. no duplicate
+	// blocks), there is no relative change to bound and only the test is
+	// used.
+	Significant bool `json:"significant"`
+}
+
+// Regression tells whether the candidate is significantly worse.
+func (c Comparison) Regression(minChange float64) bool {
+	return c.Significant && c.Change > minChange
+}
+
+// Improvement tells whether the candidate is significantly better.
+func (c Comparison) Improvement(minChange float64) bool {
+	return c.Significant && c.Change < -minChange
+}
+
+// Compare matches the metrics of the baseline and candidate records by
+// permutation, labels, node type and metric, and compares the samples of every
+// match. Keys missing in either side are skipped. Comparisons are sorted by
+// key.
+func Compare(baseline, candidate []Record, opts CompareOptions) []Comparison {
+	metrics := make(map[string]bool)
+	for _, m := range opts.Metrics {
+		metrics[m] = true
+	}
+	group := func(records []Record) map[Key][]float64 {
+		groups := make(map[Key][]float64)
+		for _, r := range records {
+			if !metrics[r.Name] {
+				continue
+			}
+			k := keyOf(r)
+			groups[k] = append(groups[k], r.Value)
+		}
+		return groups
+	}
+	base, cand := group(baseline), group(candidate)
+
+	var keys []Key
+	for k := range base {
+		if _, ok := cand[k]; ok {
+			keys = append(keys, k)
+		}
+	}
+	// Resample in the order of the keys, so that comparisons are reproducible.
+	sort.Slice(keys, func(i, j int) bool { return keys[i].less(keys[j]) })
+
+	rng := rand.New(rand.NewSource(opts.Seed))
+	alpha := 1 - opts.Confidence
+	comps := make([]Comparison, 0, len(keys))
+	for _, k := range keys {
+		x, y := base[k], cand[k]
+		c := Comparison{Key: k, Baseline: Summarize(x), Candidate: Summarize(y)}
+		c.Diff = c.Candidate.Mean - c.Baseline.Mean
+		c.Change = relativeChange(c.Baseline.Mean, c.Candidate.Mean)
+		c.PValue = MannWhitney(x, y)
+		if c.Baseline.Mean == 0 {
+			c.CILow, c.CIHigh = math.NaN(), math.NaN()
+			c.Significant = c.PValue < alpha
+		} else {
+			c.CILow, c.CIHigh = bootstrapChange(rng, x, y, opts.Resamples, opts.Confidence)
+			c.Significant = (c.CILow > 0 || c.CIHigh < 0) && c.PValue < alpha
+		}
+		comps = append(comps, c)
+	}
+	return comps
+}
+
+// relativeChange returns the change from a to b relative to a.
+func relativeChange(a, b float64) float64 {
+	if a == b {
+		return 0
+	}
+	if a == 0 {
+		return math.Copysign(math.Inf(1), b)
+	}
+	return (b - a) / math.Abs(a)
+}
+
+// bootstrapChange returns the percentile bootstrap confidence interval of the
+// relative change of the mean from x to y.
+func bootstrapChange(rng *rand.Rand, x, y []float64, resamples int, confidence float64) (float64, float64) {
+	if resamples <= 0 {
+		return math.NaN(), math.NaN()
+	}
+	resampledMean := func(values []float64) float64 {
+		var sum float64
+		for range values {
+			sum += values[rng.Intn(len(values))]
+		}
+		return sum / float64(len(values))
+	}
+	changes := make([]float64, resamples)
+	for i := range changes {
+		changes[i] = relativeChange(resampledMean(x), resampledMean(y))
+	}
+	sort.Float64s(changes)
+	tail := (1 - confidence) / 2 * 100
+	return Percentile(changes, tail), Percentile(changes, 100-tail)
+}
+
+// MannWhitney returns the two-sided p-value of the Mann-Whitney U test of the
+// samples, using the normal approximation with continuity and ties
+// correction.
+func MannWhitney(x, y []float64) float64 {
+	n1, n2 := float64(len(x)), float64(len(y))
+	if n1 == 0 || n2 == 0 {
+		return math.NaN()
+	}
+	type sample struct {
+		value float64
+		first bool
+	}
+	all := make([]sample, 0, len(x)+len(y))
+	for _, v := range x {
+		all = append(all, sample{v, true})
+	}
+	for _, v := range y {
+		all = append(all, sample{v, false})
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].value < all[j].value })
+
+	// Sum the ranks of x, averaging the ranks of ties.
+	var rankSum, ties float64
+	for i := 0; i < len(all); {
+		j := i
+		for j < len(all) && all[j].value == all[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for _, s := range all[i:j] {
+			if s.first {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+
+	u := rankSum - n1*(n1+1)/2
+	n := n1 + n2
+	mean := n1 * n2 / 2
+	variance := n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1)))
+	if variance <= 0 {
+		// All the values are equal.
+		return 1
+	}
+	z := (math.Abs(u-mean) - 0.5) / math.Sqrt(variance)
+	if z < 0 {
+		z = 0
+	}
+	return math.Erfc(z / math.Sqrt2)
+}
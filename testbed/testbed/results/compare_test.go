@@ -0,0 +1,199 @@
+package results
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestMannWhitney(t *testing.T) {
+	cases := []struct {
+		name     string
+		x, y     []float64
+		expected float64
+	}{
+		// Values of scipy.stats.mannwhitneyu(x, y, method="asymptotic").
+		{name: "separated", x: []float64{1, 2, 3, 4, 5}, y: []float64{6, 7, 8, 9, 10}, expected: 0.01219},
+		{name: "ties", x: []float64{1, 2, 2, 3}, y: []float64{2, 3, 3, 4}, expected: 0.1720},
+		{name: "equal", x: []float64{1, 1, 1}, y: []float64{1, 1}, expected: 1},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			if p := MannWhitney(tt.x, tt.y); math.Abs(p-tt.expected) > 1e-4 {
+				t.Errorf("got p-value %g, expected %g", p, tt.expected)
+			}
+			// The test is symmetric.
+			if p := MannWhitney(tt.y, tt.x); math.Abs(p-tt.expected) > 1e-4 {
+				t.Errorf("got p-value %g swapping the samples, expected %g", p, tt.expected)
+			}
+		})
+	}
+}
+
+// samples returns records of the metric of leeches with the values.
+func samples(transport, metric string, values ...float64) []Record {
+	var records []Record
+	for _, v := range values {
+		records = append(records, Record{
+			Permutation: Permutation{Transport: transport},
+			NodeType:    "Leech",
+			Name:        metric,
+			Value:       v,
+		})
+	}
+	return records
+}
+
+func TestCompare(t *testing.T) {
+	var baseline, candidate []Record
+	// time_to_fetch regresses by ~50% with bitswap and doesn't change with
+	// graphsync, data_sent improves and dup_blks_rcvd is only in the baseline.
+	baseline = append(baseline, samples("bitswap", "time_to_fetch", 100, 102, 98, 101, 99, 100, 103, 97)...)
+	candidate = append(candidate, samples("bitswap", "time_to_fetch", 150, 152, 148, 151, 149, 150, 153, 147)...)
+	baseline = append(baseline, samples("graphsync", "time_to_fetch", 100, 102, 98, 101, 99, 100, 103, 97)...)
+	candidate = append(candidate, samples("graphsync", "time_to_fetch", 101, 99, 103, 97, 100, 102, 98, 100)...)
+	baseline = append(baseline, samples("bitswap", "data_sent", 10, 11, 9, 10, 10, 11, 9, 10)...)
+	candidate = append(candidate, samples("bitswap", "data_sent", 5, 6, 4, 5, 5, 6, 4, 5)...)
+	baseline = append(baseline, samples("bitswap", "dup_blks_rcvd", 1, 2, 3)...)
+	// Metrics not compared are ignored.
+	baseline = append(baseline, samples("bitswap", "blks_rcvd", 1, 2, 3)...)
+	candidate = append(candidate, samples("bitswap", "blks_rcvd", 10, 20, 30)...)
+
+	opts := CompareOptions{Metrics: DefaultCompareMetrics, Confidence: 0.95, Resamples: 1000, Seed: 1, MinChange: 0.05}
+	comps := Compare(baseline, candidate, opts)
+	if len(comps) != 3 {
+		t.Fatalf("got %d comparisons, expected 3: %+v", len(comps), comps)
+	}
+
+	type result struct {
+		transport, metric       string
+		change                  float64
+		regression, improvement bool
+	}
+	expected := []result{
+		{"bitswap", "data_sent", -0.5, false, true},
+		{"bitswap", "time_to_fetch", 0.5, true, false},
+		{"graphsync", "time_to_fetch", 0, false, false},
+	}
+	for i, c := range comps {
+		e := expected[i]
+		if c.Transport != e.transport || c.Metric != e.metric {
+			t.Fatalf("comparison %d is %s/%s, expected %s/%s", i, c.Transport, c.Metric, e.transport, e.metric)
+		}
+		if math.Abs(c.Change-e.change) > 1e-9 {
+			t.Errorf("%s/%s: got change %g, expected %g", e.transport, e.metric, c.Change, e.change)
+		}
+		if c.CILow > c.Change || c.CIHigh < c.Change {
+			t.Errorf("%s/%s: change %g out of the interval [%g, %g]", e.transport, e.metric, c.Change, c.CILow, c.CIHigh)
+		}
+		if c.Regression(opts.MinChange) != e.regression || c.Improvement(opts.MinChange) != e.improvement {
+			t.Errorf("%s/%s: got regression %t and improvement %t, expected %t and %t", e.transport, e.metric,
+				c.Regression(opts.MinChange), c.Improvement(opts.MinChange), e.regression, e.improvement)
+		}
+	}
+
+	// The bootstrap is reproducible with the same seed.
+	again := Compare(baseline, candidate, opts)
+	for i := range comps {
+		if comps[i] != again[i] {
+			t.Errorf("got %+v comparing again, expected %+v", again[i], comps[i])
+		}
+	}
+
+	var md bytes.Buffer
+	if err := WriteReport(&md, "markdown", comps, opts); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"1 regressions and 1 improvements in 3 comparisons", "## Regressions", "| transport | node_type |", "| bitswap | Leech | time_to_fetch |", "**regression**"} {
+		if !strings.Contains(md.String(), s) {
+			t.Errorf("markdown report missing %q:\n%s", s, md.String())
+		}
+	}
+	var h bytes.Buffer
+	if err := WriteReport(&h, "html", comps, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(h.String(), `<tr class="regression"><td>bitswap</td>`) {
+		t.Errorf("html report missing the regression:\n%s", h.String())
+	}
+	if err := WriteReport(&h, "pdf", comps, opts); err == nil {
+		t.Error("expected an error with an unknown format")
+	}
+}
+
+func TestCompareZeroBaseline(t *testing.T) {
+	// Duplicate blocks appear in the candidate and not in the baseline.
+	baseline := samples("bitswap", "dup_blks_rcvd", 0, 0, 0, 0, 0, 0, 0, 0, 0, 0)
+	candidate := samples("bitswap", "dup_blks_rcvd", 40, 45, 42, 44, 41, 43, 46, 42, 44, 43)
+	// Both without duplicates.
+	baseline = append(baseline, samples("graphsync", "dup_blks_rcvd", 0, 0, 0)...)
+	candidate = append(candidate, samples("graphsync", "dup_blks_rcvd", 0, 0, 0)...)
+
+	opts := CompareOptions{Metrics: DefaultCompareMetrics, Confidence: 0.95, Resamples: 1000, Seed: 1, MinChange: 0.05}
+	comps := Compare(baseline, candidate, opts)
+	if len(comps) != 2 {
+		t.Fatalf("got %d comparisons, expected 2: %+v", len(comps), comps)
+	}
+	if c := comps[0]; !c.Regression(opts.MinChange) || c.Diff != 43 || !math.IsInf(c.Change, 1) {
+		t.Errorf("expected a regression of +43 from 0, got %+v", c)
+	}
+	if c := comps[1]; c.Significant || c.Change != 0 || c.Diff != 0 {
+		t.Errorf("expected no change, got %+v", c)
+	}
+
+	var md bytes.Buffer
+	if err := WriteReport(&md, "markdown", comps, opts); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(md.String(), "| bitswap | Leech | dup_blks_rcvd | 0 (n=10) | 43 (n=10) | +43 | n/a |") {
+		t.Errorf("markdown report missing the absolute change:\n%s", md.String())
+	}
+}
+
+func TestCompareLabels(t *testing.T) {
+	// Series of a labeled metric are compared on their own.
+	label := func(records []Record, arrivalMS string) []Record {
+		for i := range records {
+			records[i].Labels = map[string]string{"arrivalMS": arrivalMS}
+		}
+		return records
+	}
+	var baseline, candidate []Record
+	baseline = append(baseline, label(samples("bitswap", "block_arrivals", 10, 11, 9, 10, 10), "8")...)
+	baseline = append(baseline, label(samples("bitswap", "block_arrivals", 1, 2, 1, 2, 1), "16")...)
+	candidate = append(candidate, label(samples("bitswap", "block_arrivals", 10, 9, 11, 10, 10), "8")...)
+	candidate = append(candidate, label(samples("bitswap", "block_arrivals", 1, 1, 2, 2, 1), "16")...)
+
+	comps := Compare(baseline, candidate, CompareOptions{Metrics: []string{"block_arrivals"}, Confidence: 0.95, Resamples: 100})
+	if len(comps) != 2 || comps[0].Labels != "arrivalMS=8" || comps[1].Labels != "arrivalMS=16" {
+		t.Fatalf("expected a comparison per bucket, got %+v", comps)
+	}
+	for _, c := range comps {
+		if c.Change != 0 {
+			t.Errorf("%s: got change %g, expected none", c.Labels, c.Change)
+		}
+	}
+}
+
+func TestPercentileInf(t *testing.T) {
+	inf := math.Inf(1)
+	cases := []struct {
+		sorted   []float64
+		p        float64
+		expected float64
+	}{
+		{[]float64{inf, inf, inf}, 2.5, inf},
+		{[]float64{inf, inf, inf}, 97.5, inf},
+		{[]float64{1, 2, inf, inf}, 0, 1},
+		{[]float64{1, 2, inf, inf}, 100, inf},
+		{[]float64{1, 2, inf, inf}, 60, inf},
+		{[]float64{-inf, 1, 2}, 0, -inf},
+		{[]float64{1, 2, 3}, 25, 1.5},
+	}
+	for _, tt := range cases {
+		if v := Percentile(tt.sorted, tt.p); v != tt.expected {
+			t.Errorf("Percentile(%v, %g) = %g, expected %g", tt.sorted, tt.p, v, tt.expected)
+		}
+	}
+}
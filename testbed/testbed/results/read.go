@@ -0,0 +1,69 @@
+package results
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ResultsFile is the file where Testground writes the metrics of an instance.
+const ResultsFile = "results.out"
+
+// metric is a line of a results file.
+type metric struct {
+	Type     string             `json:"type"`
+	Name     string             `json:"name"`
+	Measures map[string]float64 `json:"measures"`
+}
+
+// ReadDir reads the records of all the results files under the directory.
+func ReadDir(dir string) ([]Record, error) {
+	var records []Record
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != ResultsFile {
+			return nil
+		}
+		rs, err := ReadFile(path)
+		if err != nil {
+			return err
+		}
+		records = append(records, rs...)
+		return nil
+	})
+	return records, err
+}
+
+// ReadFile reads the records of the points in a results file. Other types of
+// metrics are skipped.
+func ReadFile(path string) ([]Record, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []Record
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var m metric
+		if err := json.Unmarshal(scanner.Bytes(), &m); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if m.Type != "point" {
+			continue
+		}
+		r, err := ParseName(m.Name)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		r.Value = m.Measures["value"]
+		records = append(records, r)
+	}
+	return records, scanner.Err()
+}
@@ -0,0 +1,149 @@
+// Package results reads the metrics recorded by the test cases into typed
+// records and aggregates them by permutation.
+package results
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Permutation holds the parameters of the test permutation a metric was
+// recorded in.
+type Permutation struct {
+	Seeds             int     `json:"seeds"`
+	Leeches           int     `json:"leeches"`
+	Passives          int     `json:"passives"`
+	Transport         string  `json:"transport"`
+	MaxConnectionRate int     `json:"max_connection_rate"`
+	LatencyMS         int64   `json:"latency_ms"`
+	BandwidthMB       int     `json:"bandwidth_mb"`
+	LossPct           float64 `json:"loss_pct"`
+	CorruptPct        float64 `json:"corrupt_pct"`
+	ReorderPct        float64 `json:"reorder_pct"`
+	DuplicatePct      float64 `json:"duplicate_pct"`
+	FileSize          int64   `json:"file_size"`
+	Layout            string  `json:"layout"`
+	Chunker           string  `json:"chunker"`
+	RawLeaves         bool    `json:"raw_leaves"`
+	HashFunc          string  `json:"hash_func"`
+	MaxLinks          int     `json:"max_links"`
+	CidVersion        int     `json:"cid_version"`
+}
+
+// Record is a metric recorded by a node in a run of a permutation.
+type Record struct {
+	Permutation
+	Run           int
+	Seq           int64
+	GroupName     string
+	GroupSeq      int64
+	NodeType      string
+	NodeTypeIndex int
+	// Labels holds the labels added to some metrics (e.g. the step of a
+	// network schedule or the item of a catalog request).
+	Labels map[string]string
+	Name   string
+	Value  float64
+}
+
+// ParseName parses the name of a metric. Names are either the metric name
+// followed by its labels as Testground tags ("time_to_fetch,transport=bitswap")
+// or, with the legacy format, a list of key:value labels separated by slashes
+// ("transport:bitswap/name:time_to_fetch"). Legacy values may contain colons.
+func ParseName(name string) (Record, error) {
+	labels := make(map[string]string)
+	parts := strings.Split(name, ",")
+	if !strings.Contains(parts[0], ":") {
+		labels["name"] = parts[0]
+		for _, part := range parts[1:] {
+			kv := strings.SplitN(part, "=", 2)
+			if len(kv) != 2 {
+				return Record{}, fmt.Errorf("invalid tag %q in metric %q", part, name)
+			}
+			labels[kv[0]] = kv[1]
+		}
+	} else {
+		for _, part := range strings.Split(name, "/") {
+			kv := strings.SplitN(part, ":", 2)
+			if len(kv) != 2 {
+				return Record{}, fmt.Errorf("invalid label %q in metric %q", part, name)
+			}
+			labels[kv[0]] = kv[1]
+		}
+	}
+	r, err := fromLabels(labels)
+	if err != nil {
+		return Record{}, fmt.Errorf("invalid metric %q: %w", name, err)
+	}
+	return r, nil
+}
+
+// fromLabels builds the record with the metric name and the labels of its
+// permutation and node. Labels missing in older results are left unset, and
+// unknown labels are kept in the labels of the record.
+func fromLabels(labels map[string]string) (Record, error) {
+	var r Record
+	var err error
+	// set parses the value of the label with the parse function, if set.
+	set := func(key string, parse func(string) error) {
+		v, ok := labels[key]
+		if !ok || err != nil {
+			return
+		}
+		delete(labels, key)
+		if perr := parse(v); perr != nil {
+			err = fmt.Errorf("invalid %s %q: %w", key, v, perr)
+		}
+	}
+	str := func(dst *string) func(string) error {
+		return func(v string) error { *dst = v; return nil }
+	}
+	integer := func(dst *int) func(string) error {
+		return func(v string) (err error) { *dst, err = strconv.Atoi(v); return }
+	}
+	int64Of := func(dst *int64) func(string) error {
+		return func(v string) (err error) { *dst, err = strconv.ParseInt(v, 10, 64); return }
+	}
+	float := func(dst *float64) func(string) error {
+		return func(v string) (err error) { *dst, err = strconv.ParseFloat(v, 64); return }
+	}
+
+	p := &r.Permutation
+	set("topology", func(v string) error {
+		_, err := fmt.Sscanf(v, "(%d-%d-%d)", &p.Seeds, &p.Leeches, &p.Passives)
+		return err
+	})
+	set("transport", str(&p.Transport))
+	set("maxConnectionRate", integer(&p.MaxConnectionRate))
+	set("latencyMS", int64Of(&p.LatencyMS))
+	set("bandwidthMB", integer(&p.BandwidthMB))
+	set("lossPct", float(&p.LossPct))
+	set("corruptPct", float(&p.CorruptPct))
+	set("reorderPct", float(&p.ReorderPct))
+	set("duplicatePct", float(&p.DuplicatePct))
+	set("fileSize", int64Of(&p.FileSize))
+	set("layout", str(&p.Layout))
+	set("chunker", str(&p.Chunker))
+	set("rawLeaves", func(v string) (err error) { p.RawLeaves, err = strconv.ParseBool(v); return })
+	set("hashFunc", str(&p.HashFunc))
+	set("maxLinks", integer(&p.MaxLinks))
+	set("cidVersion", integer(&p.CidVersion))
+	set("run", integer(&r.Run))
+	set("seq", int64Of(&r.Seq))
+	set("groupName", str(&r.GroupName))
+	set("groupSeq", int64Of(&r.GroupSeq))
+	set("nodeType", str(&r.NodeType))
+	set("nodeTypeIndex", integer(&r.NodeTypeIndex))
+	set("name", str(&r.Name))
+	if err != nil {
+		return Record{}, err
+	}
+	if r.Name == "" {
+		return Record{}, fmt.Errorf("no metric name")
+	}
+	if len(labels) > 0 {
+		r.Labels = labels
+	}
+	return r, nil
+}
@@ -0,0 +1,118 @@
+package results
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const testName = "topology:(2-1-0)/transport:bitswap/maxConnectionRate:100/latencyMS:10/bandwidthMB:100/lossPct:0.5/corruptPct:0/reorderPct:0/duplicatePct:0/run:1/seq:3/groupName:/groupSeq:0/fileSize:1048576/nodeType:Leech/nodeTypeIndex:0/layout:balanced/chunker:rabin-16-32-64/rawLeaves:true/hashFunc:sha2-256/maxLinks:174/cidVersion:1"
+
+const testTags = "topology=(2-1-0),transport=bitswap,maxConnectionRate=100,latencyMS=10,bandwidthMB=100,lossPct=0.5,corruptPct=0,reorderPct=0,duplicatePct=0,run=1,seq=3,groupName=,groupSeq=0,fileSize=1048576,nodeType=Leech,nodeTypeIndex=0,layout=balanced,chunker=rabin-16-32-64,rawLeaves=true,hashFunc=sha2-256,maxLinks=174,cidVersion=1"
+
+func TestParseName(t *testing.T) {
+	expected := Record{
+		Permutation: Permutation{
+			Seeds: 2, Leeches: 1, Passives: 0,
+			Transport: "bitswap", MaxConnectionRate: 100, LatencyMS: 10, BandwidthMB: 100, LossPct: 0.5,
+			FileSize: 1048576, Layout: "balanced", Chunker: "rabin-16-32-64", RawLeaves: true,
+			HashFunc: "sha2-256", MaxLinks: 174, CidVersion: 1,
+		},
+		Run: 1, Seq: 3, NodeType: "Leech",
+		Name: "time_to_fetch",
+	}
+
+	cases := []struct {
+		name     string
+		metric   string
+		expected func() Record
+		invalid  bool
+	}{
+		{name: "metric", metric: testName + "/name:time_to_fetch", expected: func() Record { return expected }},
+		{name: "labels", metric: testName + "/request:2/item:7/name:request_time", expected: func() Record {
+			r := expected
+			r.Labels = map[string]string{"request": "2", "item": "7"}
+			r.Name = "request_time"
+			return r
+		}},
+		{name: "colon in name", metric: testName + "/name:a:b", expected: func() Record {
+			r := expected
+			r.Name = "a:b"
+			return r
+		}},
+		{name: "missing labels", metric: "transport:tcp/name:time_to_fetch", expected: func() Record {
+			return Record{Permutation: Permutation{Transport: "tcp"}, Name: "time_to_fetch"}
+		}},
+		{name: "tags", metric: "time_to_fetch," + testTags, expected: func() Record { return expected }},
+		{name: "tag labels", metric: "request_time," + testTags + ",request=2,item=7", expected: func() Record {
+			r := expected
+			r.Labels = map[string]string{"request": "2", "item": "7"}
+			r.Name = "request_time"
+			return r
+		}},
+		{name: "no tags", metric: "time_to_fetch", expected: func() Record { return Record{Name: "time_to_fetch"} }},
+		{name: "no name", metric: testName, invalid: true},
+		{name: "invalid tag", metric: "time_to_fetch,transport", invalid: true},
+		{name: "invalid tag number", metric: "time_to_fetch,latencyMS=ten", invalid: true},
+		{name: "no value", metric: testName + "/name", invalid: true},
+		{name: "invalid number", metric: "latencyMS:ten/name:time_to_fetch", invalid: true},
+		{name: "invalid topology", metric: "topology:2-1-0/name:time_to_fetch", invalid: true},
+	}
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := ParseName(tt.metric)
+			if tt.invalid {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", r)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := tt.expected(); !reflect.DeepEqual(r, expected) {
+				t.Errorf("got %+v, expected %+v", r, expected)
+			}
+		})
+	}
+}
+
+func TestReadDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "results")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	instance := filepath.Join(dir, "single", "0")
+	if err := os.MkdirAll(instance, 0755); err != nil {
+		t.Fatal(err)
+	}
+	lines := `{"ts":1,"type":"point","name":"` + testName + `/name:time_to_fetch","measures":{"value":1500}}
+{"ts":2,"type":"counter","name":"other","measures":{"count":1}}
+{"ts":3,"type":"point","name":"data_rcvd,` + testTags + `","measures":{"value":1048576}}
+`
+	if err := ioutil.WriteFile(filepath.Join(instance, ResultsFile), []byte(lines), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Other files are ignored.
+	if err := ioutil.WriteFile(filepath.Join(instance, "run.out"), []byte("not json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("read %d records, expected 2", len(records))
+	}
+	if records[0].Name != "time_to_fetch" || records[0].Value != 1500 {
+		t.Errorf("unexpected record %+v", records[0])
+	}
+	if records[1].Name != "data_rcvd" || records[1].Value != 1048576 {
+		t.Errorf("unexpected record %+v", records[1])
+	}
+}
@@ -0,0 +1,189 @@
+package results
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"math"
+	"strings"
+)
+
+// reportTable holds the cells of the comparisons shown in a report.
+type reportTable struct {
+	header []string
+	rows   [][]string
+	// status of every row: regression, improvement or empty.
+	status []string
+}
+
+// newReportTable builds the table of the comparisons. Permutations are shown
+// by the fields that differ among the comparisons.
+func newReportTable(comps []Comparison, opts CompareOptions) reportTable {
+	// The node type and metric are always shown.
+	n := len(keyHeader) - 2
+	var varying []int
+	for i := 0; i < n; i++ {
+		for _, c := range comps {
+			if c.Key.fields()[i] != comps[0].Key.fields()[i] {
+				varying = append(varying, i)
+				break
+			}
+		}
+	}
+
+	var t reportTable
+	for _, i := range varying {
+		t.header = append(t.header, keyHeader[i])
+	}
+	t.header = append(t.header, "node_type", "metric", "baseline", "candidate", "change",
+		fmt.Sprintf("%g%% CI", opts.Confidence*100), "p-value", "status")
+	for _, c := range comps {
+		fields := c.Key.fields()
+		var row []string
+		for _, i := range varying {
+			row = append(row, fields[i])
+		}
+		change := formatChange(c.Change)
+		ci := fmt.Sprintf("[%s, %s]", formatChange(c.CILow), formatChange(c.CIHigh))
+		if c.Baseline.Mean == 0 {
+			// No relative change from 0, show the absolute one.
+			change = fmt.Sprintf("%+.4g", c.Diff)
+			ci = "n/a"
+		}
+		row = append(row, c.NodeType, c.Metric,
+			fmt.Sprintf("%.4g (n=%d)", c.Baseline.Mean, c.Baseline.Count),
+			fmt.Sprintf("%.4g (n=%d)", c.Candidate.Mean, c.Candidate.Count),
+			change, ci, fmt.Sprintf("%.3g", c.PValue))
+		status := ""
+		if c.Regression(opts.MinChange) {
+			status = "regression"
+		} else if c.Improvement(opts.MinChange) {
+			status = "improvement"
+		}
+		t.rows = append(t.rows, append(row, status))
+		t.status = append(t.status, status)
+	}
+	return t
+}
+
+// count returns the number of rows with the status.
+func (t reportTable) count(status string) int {
+	var n int
+	for _, s := range t.status {
+		if s == status {
+			n++
+		}
+	}
+	return n
+}
+
+// summary describes the result of the comparison in a sentence.
+func (t reportTable) summary(opts CompareOptions) string {
+	return fmt.Sprintf("%d regressions and %d improvements in %d comparisons "+
+		"(%g%% confidence, changes of the mean over %g%%, %d bootstrap resamples).",
+		t.count("regression"), t.count("improvement"), len(t.rows),
+		opts.Confidence*100, opts.MinChange*100, opts.Resamples)
+}
+
+func formatChange(f float64) string {
+	if math.IsNaN(f) {
+		return "n/a"
+	}
+	return fmt.Sprintf("%+.1f%%", f*100)
+}
+
+// WriteMarkdown writes a markdown report of the comparisons, listing the
+// regressions first.
+func WriteMarkdown(w io.Writer, comps []Comparison, opts CompareOptions) error {
+	t := newReportTable(comps, opts)
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Comparison report\n\n%s\n", t.summary(opts))
+
+	writeTable := func(title, status string) {
+		fmt.Fprintf(&b, "\n## %s\n\n", title)
+		fmt.Fprintf(&b, "| %s |\n", strings.Join(t.header, " | "))
+		fmt.Fprintf(&b, "|%s\n", strings.Repeat(" --- |", len(t.header)))
+		for i, row := range t.rows {
+			if status != "" && t.status[i] != status {
+				continue
+			}
+			cells := make([]string, len(row))
+			for j, c := range row {
+				cells[j] = strings.ReplaceAll(c, "|", `\|`)
+			}
+			if t.status[i] == "regression" {
+				cells[len(cells)-1] = "**regression**"
+			}
+			fmt.Fprintf(&b, "| %s |\n", strings.Join(cells, " | "))
+		}
+	}
+	if t.count("regression") > 0 {
+		writeTable("Regressions", "regression")
+	}
+	writeTable("All metrics", "")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteHTML writes an HTML report of the comparisons, listing the
+// regressions first.
+func WriteHTML(w io.Writer, comps []Comparison, opts CompareOptions) error {
+	t := newReportTable(comps, opts)
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Comparison report</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+tr.regression { background: #fdd; }
+tr.improvement { background: #dfd; }
+</style>
+</head>
+<body>
+<h1>Comparison report</h1>
+`)
+	fmt.Fprintf(&b, "<p>%s</p>\n", html.EscapeString(t.summary(opts)))
+
+	writeTable := func(title, status string) {
+		fmt.Fprintf(&b, "<h2>%s</h2>\n<table>\n<tr>", html.EscapeString(title))
+		for _, h := range t.header {
+			fmt.Fprintf(&b, "<th>%s</th>", html.EscapeString(h))
+		}
+		b.WriteString("</tr>\n")
+		for i, row := range t.rows {
+			if status != "" && t.status[i] != status {
+				continue
+			}
+			fmt.Fprintf(&b, `<tr class="%s">`, t.status[i])
+			for _, c := range row {
+				fmt.Fprintf(&b, "<td>%s</td>", html.EscapeString(c))
+			}
+			b.WriteString("</tr>\n")
+		}
+		b.WriteString("</table>\n")
+	}
+	if t.count("regression") > 0 {
+		writeTable("Regressions", "regression")
+	}
+	writeTable("All metrics", "")
+	b.WriteString("</body>\n</html>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteReport writes a report of the comparisons in the format, markdown or
+// html.
+func WriteReport(w io.Writer, format string, comps []Comparison, opts CompareOptions) error {
+	switch format {
+	case "markdown", "md":
+		return WriteMarkdown(w, comps, opts)
+	case "html":
+		return WriteHTML(w, comps, opts)
+	default:
+		return fmt.Errorf("unknown format %q", format)
+	}
+}
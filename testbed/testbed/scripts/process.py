@@ -32,12 +32,20 @@ def parse_args():
 #         if len(res[""])
 def process_result_line(l):
     l = json.loads(l)
-    name = l["name"].split('/')
+    name = l["name"].split(',')
     value = (l["measures"])["value"]
     item = {}
-    for attr in name:
-        attr = attr.split(":")
-        item[attr[0]] = attr[1]
+    if ":" not in name[0]:
+        # Metric name followed by its tags (name,key=value,...)
+        item["name"] = name[0]
+        for attr in name[1:]:
+            attr = attr.split("=", 1)
+            item[attr[0]] = attr[1]
+    else:
+        # Legacy format (key:value/.../name:metric)
+        for attr in l["name"].split('/'):
+            attr = attr.split(":", 1)
+            item[attr[0]] = attr[1]
     item["value"] = value
     return item
 
@@ -0,0 +1,174 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"os"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/protocol/beyond-bitswap/testbed/testbed/utils"
+	"github.com/testground/sdk-go/runtime"
+	"github.com/testground/sdk-go/sync"
+)
+
+// Arrival processes of the leeches.
+const (
+	// ArrivalWaves splits the leeches in number_waves waves.
+	ArrivalWaves = "waves"
+	// ArrivalPoisson starts the leeches following a Poisson process.
+	ArrivalPoisson = "poisson"
+	// ArrivalBurst starts the leeches in bursts of the same size.
+	ArrivalBurst = "burst"
+	// ArrivalList starts every leech at a given time.
+	ArrivalList = "list"
+)
+
+// ArrivalParams configures when the leeches start fetching.
+type ArrivalParams struct {
+	Process string
+	// Rate of the Poisson process, in leeches per second.
+	Rate float64
+	// Seed of the Poisson process.
+	Seed int64
+	// Size of the bursts and time between them. A single burst of all the
+	// leeches is a flash crowd.
+	BurstSize     int
+	BurstInterval time.Duration
+	// Times is the arrival time of every leech, by index.
+	Times []time.Duration
+	// LeechBecomesSeed makes leeches serve the file to later arrivals once
+	// they fetched it.
+	LeechBecomesSeed bool
+}
+
+// arrivalTimes returns the time since the start of the transfer at which every
+// leech starts fetching, by index. Every instance computes the same times.
+func (p ArrivalParams) arrivalTimes(leechCount int) ([]time.Duration, error) {
+	times := make([]time.Duration, leechCount)
+	switch p.Process {
+	case ArrivalPoisson:
+		if p.Rate <= 0 {
+			return nil, fmt.Errorf("Poisson arrivals need a positive arrival_rate, got %g", p.Rate)
+		}
+		r := rand.New(rand.NewSource(p.Seed))
+		var at float64
+		for i := range times {
+			// Time between arrivals is exponentially distributed.
+			at += r.ExpFloat64() / p.Rate
+			times[i] = time.Duration(at * float64(time.Second))
+		}
+	case ArrivalBurst:
+		if p.BurstSize <= 0 {
+			return nil, fmt.Errorf("Burst arrivals need a positive burst_size, got %d", p.BurstSize)
+		}
+		for i := range times {
+			times[i] = time.Duration(i/p.BurstSize) * p.BurstInterval
+		}
+	case ArrivalList:
+		if len(p.Times) < leechCount {
+			return nil, fmt.Errorf("%d arrival times for %d leeches", len(p.Times), leechCount)
+		}
+		copy(times, p.Times)
+	default:
+		return nil, fmt.Errorf("Unknown arrival process %q", p.Process)
+	}
+	return times, nil
+}
+
+// leechArrival is when a leech started fetching and the seeds it knew about.
+type leechArrival struct {
+	at    time.Duration
+	peers []utils.PeerInfo
+	// Number of seeds, including leeches that became seeds.
+	seeds int
+}
+
+// getNewSeedsTopic is where leeches that became seeds announce themselves.
+func getNewSeedsTopic(runID string) *sync.Topic {
+	return sync.NewTopic("new-seeds-"+runID, &utils.PeerInfo{})
+}
+
+// arrive waits for the arrival time of the leech and returns the peers to
+// fetch from, including the leeches that became seeds until then.
+func (t *NodeTestData) arrive(ctx context.Context, runenv *runtime.RunEnv, runID string,
+	start time.Time, testvars *TestVars) (*leechArrival, error) {
+	if t.tpindex >= len(testvars.ArrivalTimes) {
+		return nil, fmt.Errorf("No arrival time for leech %d", t.tpindex)
+	}
+	at := testvars.ArrivalTimes[t.tpindex]
+
+	sctx, cancelSub := context.WithCancel(ctx)
+	defer cancelSub()
+	var newSeeds chan *utils.PeerInfo
+	if testvars.Arrivals.LeechBecomesSeed {
+		newSeeds = make(chan *utils.PeerInfo, testvars.LeechCount)
+		if _, err := t.client.Subscribe(sctx, getNewSeedsTopic(runID), newSeeds); err != nil {
+			return nil, fmt.Errorf("Failed to subscribe to new seeds %w", err)
+		}
+	}
+
+	runenv.RecordMessage("Leech fetching data after %s", at)
+	peers := append([]utils.PeerInfo(nil), t.peerInfos...)
+	wait := time.After(time.Until(start.Add(at)))
+	for arrived := false; !arrived; {
+		select {
+		case <-wait:
+			arrived = true
+		case inf := <-newSeeds:
+			peers = append(peers, *inf)
+			// Later arrivals may not be connected to the leech.
+			if err := t.node.Host().Connect(ctx, inf.Addr); err != nil {
+				runenv.RecordMessage("Error connecting to new seed %s: %v", inf.Addr.ID, err)
+			}
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	a := &leechArrival{at: at, peers: peers}
+	for _, p := range peers {
+		if p.Nodetp == utils.Seed {
+			a.seeds++
+		}
+	}
+	runenv.RecordMessage("Leech arrived after %s with %d seeds", at, a.seeds)
+	return a, nil
+}
+
+// becomeSeed serves the fetched file to the leeches arriving later. Nodes
+// exchanging blocks already serve them, but nodes serving files need to add
+// the fetched file, which starts their server if they don't have one yet.
+func (t *NodeTestData) becomeSeed(ctx context.Context, runenv *runtime.RunEnv, runID string, fetchPath string) error {
+	if t.node.DAGService() == nil {
+		stat, err := os.Stat(fetchPath)
+		if err != nil {
+			return err
+		}
+		f, err := files.NewSerialFile(fetchPath, false, stat)
+		if err != nil {
+			return err
+		}
+		if _, err := t.node.Add(ctx, f); err != nil {
+			return fmt.Errorf("Failed to serve the fetched file %w", err)
+		}
+	}
+	inf := t.selfInfo()
+	inf.Nodetp = utils.Seed
+	if _, err := t.client.Publish(ctx, getNewSeedsTopic(runID), &inf); err != nil {
+		return fmt.Errorf("Failed to publish new seed %w", err)
+	}
+	runenv.RecordMessage("Leech became a seed")
+	return nil
+}
+
+// emit records the arrival time of the leech and the number of seeds it could
+// fetch from, to measure how the capacity of the swarm grows.
+func (a *leechArrival) emit(mr *metricsRecorder) {
+	if a == nil {
+		return
+	}
+	mr.Record("arrival_ms", float64(a.at.Milliseconds()))
+	mr.Record("seeds_available", float64(a.seeds))
+}
@@ -0,0 +1,198 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"strconv"
+	gosync "sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/protocol/beyond-bitswap/testbed/testbed/utils"
+	"github.com/testground/sdk-go/runtime"
+	"github.com/testground/sdk-go/sync"
+)
+
+// Popularity distributions of the items of a catalog.
+const (
+	PopularityZipf    = "zipf"
+	PopularityUniform = "uniform"
+)
+
+// CatalogParams configures workloads where seeds publish a catalog of files
+// and leeches request a sequence of items drawn from a popularity distribution.
+type CatalogParams struct {
+	// Size is the number of items of the catalog. Single file workloads have
+	// no catalog.
+	Size int
+	// Requests of every leech and how many of them are in flight at once.
+	Requests    int
+	Concurrency int
+	Popularity  string
+	// Parameters of the Zipf distribution: P(k) is proportional to (v + k)^(-s).
+	ZipfS float64
+	ZipfV float64
+	// Seed of the requests. Every leech draws a different sequence.
+	Seed int64
+}
+
+func (p CatalogParams) enabled() bool {
+	return p.Size > 0
+}
+
+// draw returns the items requested by the leech.
+func (p CatalogParams) draw(tpindex int) []int {
+	r := rand.New(rand.NewSource(p.Seed + int64(tpindex)))
+	var next func() int
+	if p.Popularity == PopularityZipf {
+		z := rand.NewZipf(r, p.ZipfS, p.ZipfV, uint64(p.Size-1))
+		next = func() int { return int(z.Uint64()) }
+	} else {
+		next = func() int { return r.Intn(p.Size) }
+	}
+	items := make([]int, p.Requests)
+	for i := range items {
+		items[i] = next()
+	}
+	return items
+}
+
+// catalogItems is the list of root CIDs of the items of a catalog, from the
+// most to the least popular.
+type catalogItems struct {
+	Cids []cid.Cid
+}
+
+func getCatalogTopic(id int) *sync.Topic {
+	return sync.NewTopic(fmt.Sprintf("catalog-%d", id), &catalogItems{})
+}
+
+// addPublishCatalog adds every item of the catalog and publishes their CIDs.
+// Items are generated like the file of the permutation, with different seeds.
+func (t *NodeTestData) addPublishCatalog(ctx context.Context, fIndex int, f utils.TestFile, runenv *runtime.RunEnv, testvars *TestVars) ([]cid.Cid, error) {
+	rate := float64(testvars.SeederRate) / 100
+	seeders := runenv.TestInstanceCount - (testvars.LeechCount + testvars.PassiveCount)
+	toSeed := int(math.Ceil(float64(seeders) * rate))
+
+	// Only a rate of seeders add the catalog.
+	if t.tpindex > toSeed {
+		return nil, nil
+	}
+	items, err := utils.CatalogFiles(f, testvars.Catalog.Size)
+	if err != nil {
+		return nil, err
+	}
+	var cids []cid.Cid
+	for _, item := range items {
+		c, err := generateAndAdd(ctx, runenv, t.node, item)
+		if err != nil {
+			return nil, err
+		}
+		err = fractionalDAG(ctx, runenv, int(t.seedIndex), *c, t.node.DAGService())
+		if err != nil {
+			return nil, err
+		}
+		cids = append(cids, *c)
+	}
+
+	runenv.RecordMessage("Published catalog of %d items", len(cids))
+	if _, err := t.client.Publish(ctx, getCatalogTopic(fIndex), &catalogItems{cids}); err != nil {
+		return nil, fmt.Errorf("Failed to publish catalog %w", err)
+	}
+	return cids, nil
+}
+
+func (t *NodeTestData) readCatalog(ctx context.Context, fIndex int, runenv *runtime.RunEnv, testvars *TestVars) ([]cid.Cid, error) {
+	catalogCh := make(chan *catalogItems, 1)
+	sctx, cancelSub := context.WithCancel(ctx)
+	defer cancelSub()
+	if _, err := t.client.Subscribe(sctx, getCatalogTopic(fIndex), catalogCh); err != nil {
+		return nil, fmt.Errorf("Failed to subscribe to catalog %w", err)
+	}
+	// Every seed publishes the same catalog.
+	items, ok := <-catalogCh
+	if !ok {
+		return nil, fmt.Errorf("no catalog in %d seconds", testvars.Timeout/time.Second)
+	}
+	runenv.RecordMessage("Received catalog of %d items", len(items.Cids))
+	return items.Cids, nil
+}
+
+// catalogRequest is a request of a leech for an item of the catalog.
+type catalogRequest struct {
+	item int
+	// Time since the first request.
+	start    time.Duration
+	duration time.Duration
+	ok       bool
+}
+
+// fetchCatalog fetches the items drawn by the leech, with up to the configured
+// number of requests in flight. Items already fetched may be found locally.
+func (t *NodeTestData) fetchCatalog(ctx context.Context, runenv *runtime.RunEnv, catalog []cid.Cid,
+	peers []utils.PeerInfo, testvars *TestVars) []catalogRequest {
+	items := testvars.Catalog.draw(t.tpindex)
+	requests := make([]catalogRequest, len(items))
+	start := time.Now()
+
+	next := make(chan int)
+	var wg gosync.WaitGroup
+	for w := 0; w < testvars.Catalog.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				reqStart := time.Now()
+				err := t.fetchItem(ctx, catalog[items[i]], peers, testvars)
+				if err != nil {
+					runenv.RecordMessage("Error fetching item %d: %v", items[i], err)
+				}
+				requests[i] = catalogRequest{
+					item:     items[i],
+					start:    reqStart.Sub(start),
+					duration: time.Since(reqStart),
+					ok:       err == nil,
+				}
+			}
+		}()
+	}
+	for i := range items {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+	return requests
+}
+
+// fetchItem fetches and verifies an item of the catalog.
+func (t *NodeTestData) fetchItem(ctx context.Context, c cid.Cid, peers []utils.PeerInfo, testvars *TestVars) error {
+	rcvFile, err := t.node.Fetch(ctx, c, peers)
+	if err != nil {
+		return err
+	}
+	fetchPath := "/tmp/" + strconv.Itoa(t.tpindex) + time.Now().String()
+	if err := files.WriteTo(rcvFile, fetchPath); err != nil {
+		return err
+	}
+	defer os.RemoveAll(fetchPath)
+	return utils.VerifyFile(ctx, t.node, c, fetchPath, testvars.AddSettings)
+}
+
+// emitRequests records the start time, duration and outcome of every request,
+// labeled with its index and the requested item.
+func emitRequests(mr *metricsRecorder, requests []catalogRequest) {
+	for i, r := range requests {
+		recorder := mr.withLabel("request", i).withLabel("item", r.item)
+		recorder.Record("request_start_ms", float64(r.start.Milliseconds()))
+		recorder.Record("request_time", float64(r.duration))
+		if r.ok {
+			recorder.Record("request_ok", 1)
+		} else {
+			recorder.Record("request_ok", 0)
+		}
+	}
+}
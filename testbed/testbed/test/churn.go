@@ -0,0 +1,246 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	gosync "sync"
+	"time"
+
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protocol/beyond-bitswap/testbed/testbed/utils"
+	"github.com/testground/sdk-go/runtime"
+	"github.com/testground/sdk-go/sync"
+)
+
+// Ways nodes leave the network.
+const (
+	// ChurnConnections closes the connections of the node. Other nodes may
+	// dial it again right away.
+	ChurnConnections = "connections"
+	// ChurnHost takes the node offline: its connections are closed and so is
+	// any new one until it rejoins.
+	ChurnHost = "host"
+)
+
+// ChurnParams configures the seeds and passive nodes leaving the network
+// while the leeches fetch.
+type ChurnParams struct {
+	// Percentage of the seeds and passive nodes that leave.
+	SeedPct    int
+	PassivePct int
+	Mode       string
+	// Nodes leave at a random time within the window since the start of
+	// the transfer.
+	Window time.Duration
+	// Delay before rejoining the network. Nodes don't rejoin without it.
+	Rejoin time.Duration
+	// Seed of the random plan. A new plan is drawn every run if unset.
+	Seed   int64
+	Seeded bool
+}
+
+func (c ChurnParams) enabled() bool {
+	return c.SeedPct > 0 || c.PassivePct > 0
+}
+
+// churnEvent is when a node leaves and rejoins the network, since the start of
+// the transfer.
+type churnEvent struct {
+	Seq      int64
+	LeaveMS  int64
+	RejoinMS int64
+}
+
+// churnPlan is published by the first node so every node churns the same way.
+type churnPlan struct {
+	Events []churnEvent
+}
+
+func getChurnTopic(runID string) *sync.Topic {
+	return sync.NewTopic("churn-plan-"+runID, &churnPlan{})
+}
+
+// newChurnPlan draws the nodes that leave and when.
+func newChurnPlan(peers []utils.PeerInfo, params ChurnParams) *churnPlan {
+	seed := time.Now().UnixNano()
+	if params.Seeded {
+		seed = params.Seed
+	}
+	r := rand.New(rand.NewSource(seed))
+
+	plan := &churnPlan{}
+	pick := func(tp utils.NodeType, pct int) {
+		var candidates []int64
+		for _, p := range peers {
+			if p.Nodetp == tp {
+				candidates = append(candidates, p.Seq)
+			}
+		}
+		r.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+		n := int(math.Round(float64(len(candidates)*pct) / 100))
+		for _, seq := range candidates[:n] {
+			e := churnEvent{Seq: seq}
+			if params.Window > 0 {
+				e.LeaveMS = r.Int63n(params.Window.Milliseconds())
+			}
+			if params.Rejoin > 0 {
+				e.RejoinMS = e.LeaveMS + params.Rejoin.Milliseconds()
+			}
+			plan.Events = append(plan.Events, e)
+		}
+	}
+	pick(utils.Seed, params.SeedPct)
+	pick(utils.Passive, params.PassivePct)
+	return plan
+}
+
+// getChurnEvent publishes the plan of the run from the first node and returns
+// the event of this node, if it leaves.
+func (t *NodeTestData) getChurnEvent(ctx context.Context, runenv *runtime.RunEnv, runID string, params ChurnParams) (*churnEvent, error) {
+	topic := getChurnTopic(runID)
+	if t.seq == 1 {
+		plan := newChurnPlan(t.peerInfos, params)
+		runenv.RecordMessage("%d nodes leave the network in run %s", len(plan.Events), runID)
+		if _, err := t.client.Publish(ctx, topic, plan); err != nil {
+			return nil, fmt.Errorf("Failed to publish the churn plan %w", err)
+		}
+	}
+	if t.nodetp == utils.Leech {
+		return nil, nil
+	}
+
+	sctx, cancelSub := context.WithCancel(ctx)
+	defer cancelSub()
+	planCh := make(chan *churnPlan, 1)
+	if _, err := t.client.Subscribe(sctx, topic, planCh); err != nil {
+		return nil, fmt.Errorf("Failed to subscribe to the churn plan %w", err)
+	}
+	select {
+	case plan := <-planCh:
+		for _, e := range plan.Events {
+			if e.Seq == t.seq {
+				e := e
+				return &e, nil
+			}
+		}
+		return nil, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// churner makes the node leave and rejoin the network following its event.
+type churner struct {
+	runenv *runtime.RunEnv
+	h      host.Host
+	mode   string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	lk      gosync.Mutex
+	offline bool
+	// Peers connected when the node left.
+	peers    []peer.AddrInfo
+	notifiee *network.NotifyBundle
+	leftAt   time.Duration
+	rejoined time.Duration
+}
+
+// startChurn leaves and rejoins the network at the times of the event since now.
+func startChurn(ctx context.Context, runenv *runtime.RunEnv, h host.Host, mode string, e *churnEvent) *churner {
+	if e == nil {
+		return nil
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c := &churner{runenv: runenv, h: h, mode: mode, cancel: cancel, done: make(chan struct{})}
+	start := time.Now()
+
+	go func() {
+		defer close(c.done)
+		select {
+		case <-time.After(time.Duration(e.LeaveMS) * time.Millisecond):
+		case <-ctx.Done():
+			return
+		}
+		c.leave()
+		c.leftAt = time.Since(start)
+		runenv.RecordMessage("Left the network after %s (%s)", c.leftAt, mode)
+		if e.RejoinMS == 0 {
+			return
+		}
+		select {
+		case <-time.After(time.Until(start.Add(time.Duration(e.RejoinMS) * time.Millisecond))):
+		case <-ctx.Done():
+			return
+		}
+		c.rejoin(ctx)
+		c.rejoined = time.Since(start)
+		runenv.RecordMessage("Rejoined the network after %s", c.rejoined)
+	}()
+	return c
+}
+
+func (c *churner) leave() {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	c.offline = true
+	for _, p := range c.h.Network().Peers() {
+		c.peers = append(c.peers, c.h.Peerstore().PeerInfo(p))
+	}
+	if c.mode == ChurnHost {
+		c.notifiee = &network.NotifyBundle{
+			ConnectedF: func(_ network.Network, conn network.Conn) {
+				go conn.Close()
+			},
+		}
+		c.h.Network().Notify(c.notifiee)
+	}
+	for _, conn := range c.h.Network().Conns() {
+		conn.Close()
+	}
+}
+
+// rejoin dials again the peers the node was connected to.
+func (c *churner) rejoin(ctx context.Context) {
+	c.lk.Lock()
+	defer c.lk.Unlock()
+	if !c.offline {
+		return
+	}
+	c.offline = false
+	if c.notifiee != nil {
+		c.h.Network().StopNotify(c.notifiee)
+		c.notifiee = nil
+	}
+	for _, ai := range c.peers {
+		if err := c.h.Connect(ctx, ai); err != nil {
+			c.runenv.RecordMessage("Error rejoining peer %s: %v", ai.ID, err)
+		}
+	}
+	c.peers = nil
+}
+
+// stop stops churning and brings the node back to the network for the next run.
+func (c *churner) stop(ctx context.Context) {
+	if c == nil {
+		return
+	}
+	c.cancel()
+	<-c.done
+	c.rejoin(ctx)
+}
+
+// emit records when the node left and rejoined the network.
+func (c *churner) emit(mr *metricsRecorder) {
+	if c == nil || c.leftAt == 0 {
+		return
+	}
+	mr.Record("churn_leave_ms", float64(c.leftAt.Milliseconds()))
+	if c.rejoined > 0 {
+		mr.Record("churn_rejoin_ms", float64(c.rejoined.Milliseconds()))
+	}
+}
@@ -20,8 +20,6 @@ import (
 
 	"github.com/protocol/beyond-bitswap/testbed/testbed/utils"
 	"github.com/protocol/beyond-bitswap/testbed/testbed/utils/dialer"
-
-	"github.com/testground/sdk-go/network"
 )
 
 type TestPermutation struct {
@@ -29,6 +27,8 @@ type TestPermutation struct {
 	Bandwidth int
 	Latency   time.Duration
 	JitterPct int
+	// Packet loss, corruption, reordering and duplication.
+	Impairments utils.Impairments
 }
 
 // TestVars testing variables
@@ -47,14 +47,26 @@ type TestVars struct {
 	ProvidingEnabled  bool
 	LlEnabled         bool
 	Dialer            string
+	Topology          dialer.TopologyParams
 	NumWaves          int
 	Permutations      []TestPermutation
 	DiskStore         bool
+	AddSettings       utils.AddSettings
+	ParallelFetch     bool
+	SampleInterval    time.Duration
+	NetworkSchedule   []utils.NetworkStep
+	Partitions        []utils.Partition
+	Churn             ChurnParams
+	Arrivals          ArrivalParams
+	Catalog           CatalogParams
+	// Arrival time of every leech, unless leeches arrive in waves.
+	ArrivalTimes []time.Duration
 }
 
 type TestData struct {
-	client              *sync.DefaultClient
-	nwClient            *network.Client
+	client              sync.Client
+	nwClient            utils.NetworkClient
+	newHost             HostConstructor
 	nConfig             *utils.NodeConfig
 	peerInfos           []utils.PeerInfo
 	dialFn              dialer.Dialer
@@ -107,6 +119,24 @@ func getEnvVars(runenv *runtime.RunEnv) (*TestVars, error) {
 	if runenv.IsParamSet("dialer") {
 		tv.Dialer = runenv.StringParam("dialer")
 	}
+	if runenv.IsParamSet("dialer_seed") {
+		tv.Topology.Seed = int64(runenv.IntParam("dialer_seed"))
+	}
+	if runenv.IsParamSet("star_hub") {
+		tv.Topology.Hub = runenv.StringParam("star_hub")
+	}
+	if runenv.IsParamSet("dialer_degree") {
+		tv.Topology.Degree = runenv.IntParam("dialer_degree")
+	}
+	if runenv.IsParamSet("rewire_pct") {
+		tv.Topology.RewirePct = runenv.IntParam("rewire_pct")
+	}
+	if runenv.IsParamSet("topology_file") {
+		tv.Topology.File = runenv.StringParam("topology_file")
+	}
+	if runenv.IsParamSet("topology_format") {
+		tv.Topology.Format = runenv.StringParam("topology_format")
+	}
 	if runenv.IsParamSet("number_waves") {
 		tv.NumWaves = runenv.IntParam("number_waves")
 	}
@@ -117,6 +147,157 @@ func getEnvVars(runenv *runtime.RunEnv) (*TestVars, error) {
 		tv.DiskStore = runenv.BooleanParam("disk_store")
 	}
 
+	if runenv.IsParamSet("parallel_fetch") {
+		tv.ParallelFetch = runenv.BooleanParam("parallel_fetch")
+	}
+	if runenv.IsParamSet("sample_interval_ms") {
+		tv.SampleInterval = time.Duration(runenv.IntParam("sample_interval_ms")) * time.Millisecond
+	}
+	if runenv.IsParamSet("network_schedule") {
+		schedule, err := utils.ParseNetworkSchedule(runenv.StringParam("network_schedule"))
+		if err != nil {
+			return nil, err
+		}
+		tv.NetworkSchedule = schedule
+	}
+	if runenv.IsParamSet("partitions") {
+		partitions, err := utils.ParsePartitions(runenv.StringParam("partitions"))
+		if err != nil {
+			return nil, err
+		}
+		tv.Partitions = partitions
+	}
+
+	// Arrival process of the leeches
+	tv.Arrivals.Process = ArrivalWaves
+	if runenv.IsParamSet("arrival_process") {
+		tv.Arrivals.Process = runenv.StringParam("arrival_process")
+	}
+	if runenv.IsParamSet("arrival_rate") {
+		tv.Arrivals.Rate = runenv.FloatParam("arrival_rate")
+	}
+	if runenv.IsParamSet("arrival_seed") {
+		tv.Arrivals.Seed = int64(runenv.IntParam("arrival_seed"))
+	}
+	if runenv.IsParamSet("burst_size") {
+		tv.Arrivals.BurstSize = runenv.IntParam("burst_size")
+	}
+	if runenv.IsParamSet("burst_interval_ms") {
+		tv.Arrivals.BurstInterval = time.Duration(runenv.IntParam("burst_interval_ms")) * time.Millisecond
+	}
+	if runenv.IsParamSet("arrival_times_ms") && runenv.StringParam("arrival_times_ms") != "" {
+		times, err := utils.ParseIntArray(runenv.StringParam("arrival_times_ms"))
+		if err != nil {
+			return nil, err
+		}
+		for _, ms := range times {
+			tv.Arrivals.Times = append(tv.Arrivals.Times, time.Duration(ms)*time.Millisecond)
+		}
+	}
+	if runenv.IsParamSet("leech_becomes_seed") {
+		tv.Arrivals.LeechBecomesSeed = runenv.BooleanParam("leech_becomes_seed")
+	}
+	if tv.Arrivals.Process != ArrivalWaves {
+		arrivalTimes, err := tv.Arrivals.arrivalTimes(tv.LeechCount)
+		if err != nil {
+			return nil, err
+		}
+		tv.ArrivalTimes = arrivalTimes
+	}
+
+	// Catalog workloads
+	tv.Catalog = CatalogParams{Requests: 1, Concurrency: 1, Popularity: PopularityZipf, ZipfS: 1.1, ZipfV: 1}
+	if runenv.IsParamSet("workload") {
+		switch workload := runenv.StringParam("workload"); workload {
+		case "single":
+		case "catalog":
+			tv.Catalog.Size = 1
+			if runenv.IsParamSet("catalog_size") {
+				tv.Catalog.Size = runenv.IntParam("catalog_size")
+			}
+		default:
+			return nil, fmt.Errorf("Unknown workload %q", workload)
+		}
+	}
+	if runenv.IsParamSet("catalog_requests") {
+		tv.Catalog.Requests = runenv.IntParam("catalog_requests")
+	}
+	if runenv.IsParamSet("catalog_concurrency") {
+		tv.Catalog.Concurrency = runenv.IntParam("catalog_concurrency")
+	}
+	if runenv.IsParamSet("popularity") {
+		tv.Catalog.Popularity = runenv.StringParam("popularity")
+	}
+	if runenv.IsParamSet("zipf_s") {
+		tv.Catalog.ZipfS = runenv.FloatParam("zipf_s")
+	}
+	if runenv.IsParamSet("zipf_v") {
+		tv.Catalog.ZipfV = runenv.FloatParam("zipf_v")
+	}
+	if runenv.IsParamSet("catalog_seed") {
+		tv.Catalog.Seed = int64(runenv.IntParam("catalog_seed"))
+	}
+	if tv.Catalog.enabled() {
+		switch {
+		case tv.Catalog.Popularity != PopularityZipf && tv.Catalog.Popularity != PopularityUniform:
+			return nil, fmt.Errorf("Unknown popularity %q", tv.Catalog.Popularity)
+		case tv.Catalog.Popularity == PopularityZipf && (tv.Catalog.ZipfS <= 1 || tv.Catalog.ZipfV < 1):
+			return nil, fmt.Errorf("Zipf popularity needs zipf_s > 1 and zipf_v >= 1")
+		case tv.Catalog.Requests < 1 || tv.Catalog.Concurrency < 1:
+			return nil, fmt.Errorf("Catalog workloads need at least one request in flight")
+		}
+	}
+
+	// Churn of seeds and passive nodes
+	tv.Churn.Mode = ChurnHost
+	if runenv.IsParamSet("churn_seed_pct") {
+		tv.Churn.SeedPct = runenv.IntParam("churn_seed_pct")
+	}
+	if runenv.IsParamSet("churn_passive_pct") {
+		tv.Churn.PassivePct = runenv.IntParam("churn_passive_pct")
+	}
+	if tv.Churn.SeedPct < 0 || tv.Churn.SeedPct > 100 || tv.Churn.PassivePct < 0 || tv.Churn.PassivePct > 100 {
+		return nil, fmt.Errorf("Churn percentages must be between 0 and 100, got churn_seed_pct=%d and churn_passive_pct=%d",
+			tv.Churn.SeedPct, tv.Churn.PassivePct)
+	}
+	if runenv.IsParamSet("churn_mode") {
+		tv.Churn.Mode = runenv.StringParam("churn_mode")
+		if tv.Churn.Mode != ChurnConnections && tv.Churn.Mode != ChurnHost {
+			return nil, fmt.Errorf("Unknown churn mode %q", tv.Churn.Mode)
+		}
+	}
+	if runenv.IsParamSet("churn_window_ms") {
+		tv.Churn.Window = time.Duration(runenv.IntParam("churn_window_ms")) * time.Millisecond
+	}
+	if runenv.IsParamSet("churn_rejoin_ms") {
+		tv.Churn.Rejoin = time.Duration(runenv.IntParam("churn_rejoin_ms")) * time.Millisecond
+	}
+	if runenv.IsParamSet("churn_seed") {
+		tv.Churn.Seed = int64(runenv.IntParam("churn_seed"))
+		tv.Churn.Seeded = true
+	}
+
+	// DAG import settings
+	tv.AddSettings = utils.DefaultAddSettings
+	if runenv.IsParamSet("layout") {
+		tv.AddSettings.Layout = runenv.StringParam("layout")
+	}
+	if runenv.IsParamSet("chunker") {
+		tv.AddSettings.Chunker = runenv.StringParam("chunker")
+	}
+	if runenv.IsParamSet("raw_leaves") {
+		tv.AddSettings.RawLeaves = runenv.BooleanParam("raw_leaves")
+	}
+	if runenv.IsParamSet("hash_func") {
+		tv.AddSettings.HashFunc = runenv.StringParam("hash_func")
+	}
+	if runenv.IsParamSet("max_links") {
+		tv.AddSettings.MaxLinks = runenv.IntParam("max_links")
+	}
+	if runenv.IsParamSet("cid_version") {
+		tv.AddSettings.CidVersion = runenv.IntParam("cid_version")
+	}
+
 	bandwidths, err := utils.ParseIntArray(runenv.StringParam("bandwidth_mb"))
 	if err != nil {
 		return nil, err
@@ -129,6 +310,33 @@ func getEnvVars(runenv *runtime.RunEnv) (*TestVars, error) {
 	if err != nil {
 		return nil, err
 	}
+	losses, err := getPctParam(runenv, "loss_pct")
+	if err != nil {
+		return nil, err
+	}
+	corruptions, err := getPctParam(runenv, "corrupt_pct")
+	if err != nil {
+		return nil, err
+	}
+	reorders, err := getPctParam(runenv, "reorder_pct")
+	if err != nil {
+		return nil, err
+	}
+	duplicates, err := getPctParam(runenv, "duplicate_pct")
+	if err != nil {
+		return nil, err
+	}
+	var impairments []utils.Impairments
+	for _, l := range losses {
+		for _, c := range corruptions {
+			for _, r := range reorders {
+				for _, d := range duplicates {
+					impairments = append(impairments, utils.Impairments{LossPct: l, CorruptPct: c, ReorderPct: r, DuplicatePct: d})
+				}
+			}
+		}
+	}
+
 	testFiles, err := utils.GetFileList(runenv)
 	if err != nil {
 		return nil, err
@@ -140,7 +348,9 @@ func getEnvVars(runenv *runtime.RunEnv) (*TestVars, error) {
 			for _, l := range latencies {
 				latency := time.Duration(l) * time.Millisecond
 				for _, j := range jitters {
-					tv.Permutations = append(tv.Permutations, TestPermutation{File: f, Bandwidth: int(b), Latency: latency, JitterPct: int(j)})
+					for _, imp := range impairments {
+						tv.Permutations = append(tv.Permutations, TestPermutation{File: f, Bandwidth: int(b), Latency: latency, JitterPct: int(j), Impairments: imp})
+					}
 				}
 			}
 		}
@@ -149,9 +359,27 @@ func getEnvVars(runenv *runtime.RunEnv) (*TestVars, error) {
 	return tv, nil
 }
 
-func InitializeTest(ctx context.Context, runenv *runtime.RunEnv, testvars *TestVars) (*TestData, error) {
-	client := sync.MustBoundClient(ctx, runenv)
-	nwClient := network.NewClient(client, runenv)
+// getPctParam parses a comma-separated list of percentages between 0 and 100.
+// It defaults to 0 if the param is not set.
+func getPctParam(runenv *runtime.RunEnv, param string) ([]float64, error) {
+	if !runenv.IsParamSet(param) {
+		return []float64{0}, nil
+	}
+	pcts, err := utils.ParseFloatArray(runenv.StringParam(param))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s: %w", param, err)
+	}
+	for _, pct := range pcts {
+		if pct < 0 || pct > 100 {
+			return nil, fmt.Errorf("Invalid %s %g, must be between 0 and 100", param, pct)
+		}
+	}
+	return pcts, nil
+}
+
+func InitializeTest(ctx context.Context, runenv *runtime.RunEnv, env *Env, testvars *TestVars) (*TestData, error) {
+	client := env.Sync
+	nwClient := env.Network
 
 	nConfig, err := utils.GenerateAddrInfo(nwClient.MustGetDataNetworkIP().String())
 	if err != nil {
@@ -174,14 +402,15 @@ func InitializeTest(ctx context.Context, runenv *runtime.RunEnv, testvars *TestV
 
 	peerInfos := sync.NewTopic("peerInfos", &utils.PeerInfo{})
 	// Publish peer info for dialing
-	_, err = client.Publish(ctx, peerInfos, &utils.PeerInfo{Addr: *nConfig.AddrInfo, Nodetp: nodetp})
+	_, err = client.Publish(ctx, peerInfos, &utils.PeerInfo{Addr: *nConfig.AddrInfo, Nodetp: nodetp,
+		Seq: seq, Group: runenv.TestGroupID, Tpindex: tpindex})
 	if err != nil {
 		return nil, err
 	}
 
-	var dialFn dialer.Dialer = dialer.DialOtherPeers
-	if testvars.Dialer == "sparse" {
-		dialFn = dialer.SparseDial
+	dialFn, err := dialer.New(testvars.Dialer, testvars.Topology)
+	if err != nil {
+		return nil, err
 	}
 
 	var seedIndex int64
@@ -228,11 +457,21 @@ func InitializeTest(ctx context.Context, runenv *runtime.RunEnv, testvars *TestV
 		return err
 	}
 
-	return &TestData{client, nwClient,
+	return &TestData{client, nwClient, env.NewHost,
 		nConfig, infos, dialFn, signalAndWaitForAll,
 		seq, grpseq, nodetp, tpindex, seedIndex}, nil
 }
 
+// selfInfo returns the peer info of this node.
+func (t *TestData) selfInfo() utils.PeerInfo {
+	for _, inf := range t.peerInfos {
+		if inf.Addr.ID == t.nConfig.AddrInfo.ID {
+			return inf
+		}
+	}
+	return utils.PeerInfo{Addr: *t.nConfig.AddrInfo, Nodetp: t.nodetp, Seq: t.seq, Tpindex: t.tpindex}
+}
+
 func (t *TestData) publishFile(ctx context.Context, fIndex int, cid *cid.Cid, runenv *runtime.RunEnv) error {
 	// Create identifier for specific file size.
 	rootCidTopic := getRootCidTopic(fIndex)
@@ -366,7 +605,7 @@ func (t *NodeTestData) addPublishFile(ctx context.Context, fIndex int, f utils.T
 	}
 	return cid.Undef, nil
 }
-func (t *NodeTestData) cleanupRun(ctx context.Context, rootCid cid.Cid, runenv *runtime.RunEnv) error {
+func (t *NodeTestData) cleanupRun(ctx context.Context, rootCids []cid.Cid, runenv *runtime.RunEnv) error {
 	// Disconnect peers
 	for _, c := range t.node.Host().Network().Conns() {
 		err := c.Close()
@@ -380,20 +619,24 @@ func (t *NodeTestData) cleanupRun(ctx context.Context, rootCid cid.Cid, runenv *
 		// Clearing datastore
 		// Also clean passive nodes so they don't store blocks from
 		// previous runs.
-		if err := t.node.ClearDatastore(ctx, rootCid); err != nil {
-			return fmt.Errorf("Error clearing datastore: %w", err)
+		for _, rootCid := range rootCids {
+			if err := t.node.ClearDatastore(ctx, rootCid); err != nil {
+				return fmt.Errorf("Error clearing datastore: %w", err)
+			}
 		}
 	}
 	return nil
 }
 
-func (t *NodeTestData) cleanupFile(ctx context.Context, rootCid cid.Cid) error {
+func (t *NodeTestData) cleanupFile(ctx context.Context, rootCids []cid.Cid) error {
 	if t.nodetp == utils.Seed {
 		// Between every file close the seed Node.
 		// ipfsNode.Close()
 		// runenv.RecordMessage("Closed Seed Node")
-		if err := t.node.ClearDatastore(ctx, rootCid); err != nil {
-			return fmt.Errorf("Error clearing datastore: %w", err)
+		for _, rootCid := range rootCids {
+			if err := t.node.ClearDatastore(ctx, rootCid); err != nil {
+				return fmt.Errorf("Error clearing datastore: %w", err)
+			}
 		}
 	}
 	return nil
@@ -406,16 +649,41 @@ func (t *NodeTestData) close() error {
 	return (*t.host).Close()
 }
 
-func (t *NodeTestData) emitMetrics(runenv *runtime.RunEnv, runNum int, transport string,
-	permutation TestPermutation, timeToFetch time.Duration, tcpFetch int64, leechFails int64,
-	maxConnectionRate int) error {
+// runResult is the outcome of a run of a node, reported by emitMetrics.
+type runResult struct {
+	timeToFetch time.Duration
+	tcpFetch    int64
+	leechFails  int64
+	verifyOK    bool
+	samples     []progressSample
+	arrivals    *blockArrivals
+	netReport   networkReport
+	// When the last successful fetch ended.
+	fetchEnd time.Time
+	churn    *churner
+	arrival  *leechArrival
+	requests []catalogRequest
+}
 
-	recorder := newMetricsRecorder(runenv, runNum, t.seq, t.grpseq, transport, permutation.Latency, permutation.Bandwidth, int(permutation.File.Size()), t.nodetp, t.tpindex, maxConnectionRate)
+func (t *NodeTestData) emitMetrics(recorder *metricsRecorder, r runResult) error {
 	if t.nodetp == utils.Leech {
-		recorder.Record("time_to_fetch", float64(timeToFetch))
-		recorder.Record("leech_fails", float64(leechFails))
-		recorder.Record("tcp_fetch", float64(tcpFetch))
+		recorder.Record("time_to_fetch", float64(r.timeToFetch))
+		recorder.Record("leech_fails", float64(r.leechFails))
+		recorder.Record("tcp_fetch", float64(r.tcpFetch))
+		if r.verifyOK {
+			recorder.Record("verify_ok", 1)
+		} else {
+			recorder.Record("verify_ok", 0)
+		}
+		emitSamples(recorder, r.samples)
+		if r.arrivals != nil {
+			r.arrivals.emit(recorder)
+		}
+		r.arrival.emit(recorder)
+		emitRequests(recorder, r.requests)
 	}
+	r.netReport.emit(recorder, r.fetchEnd)
+	r.churn.emit(recorder)
 
 	return t.node.EmitMetrics(recorder)
 }
@@ -440,7 +708,7 @@ func generateAndAdd(ctx context.Context, runenv *runtime.RunEnv, node utils.Node
 	return &cid, err
 }
 
-func parseType(ctx context.Context, runenv *runtime.RunEnv, client *sync.DefaultClient, addrInfo *peer.AddrInfo, seq int64) (int64, utils.NodeType, int, error) {
+func parseType(ctx context.Context, runenv *runtime.RunEnv, client sync.Client, addrInfo *peer.AddrInfo, seq int64) (int64, utils.NodeType, int, error) {
 	leechCount := runenv.IntParam("leech_count")
 	passiveCount := runenv.IntParam("passive_count")
 
@@ -493,7 +761,7 @@ func parseType(ctx context.Context, runenv *runtime.RunEnv, client *sync.Default
 	return grpseq, nodetp, tpindex, nil
 }
 
-func getNodeSetSeq(ctx context.Context, client *sync.DefaultClient, addrInfo *peer.AddrInfo, setID string) (int64, error) {
+func getNodeSetSeq(ctx context.Context, client sync.Client, addrInfo *peer.AddrInfo, setID string) (int64, error) {
 	topic := sync.NewTopic("nodes"+setID, &peer.AddrInfo{})
 
 	return client.Publish(ctx, topic, addrInfo)
@@ -573,27 +841,105 @@ func getTCPAddrTopic(id int, run int) *sync.Topic {
 	return sync.NewTopic(fmt.Sprintf("tcp-addr-%d-%d", id, run), "")
 }
 
+// metricLabel is a dimension of the metrics of a node, e.g. its transport or
+// the run they were recorded in.
+type metricLabel struct {
+	key   string
+	value string
+}
+
+// metricsRecorder records metrics with the labels of the node and the test
+// permutation. Labels are sent as Testground tags after the name of the
+// metric ("time_to_fetch,transport=bitswap,..."), or packed in the name
+// ("transport:bitswap/.../name:time_to_fetch") with the legacy format.
 type metricsRecorder struct {
 	runenv *runtime.RunEnv
-	id     string
+	labels []metricLabel
+	legacy bool
 }
 
-func newMetricsRecorder(runenv *runtime.RunEnv, runNum int, seq int64, grpseq int64,
-	transport string, latency time.Duration, bandwidthMB int, fileSize int, nodetp utils.NodeType, tpindex int,
-	maxConnectionRate int) utils.MetricsRecorder {
+// metricLabels are the dimensions of a permutation labeling the metrics of
+// every run.
+type metricLabels struct {
+	transport         string
+	permutation       TestPermutation
+	maxConnectionRate int
+	addSettings       utils.AddSettings
+}
 
-	latencyMS := latency.Milliseconds()
+// permutationRecorder builds the recorders of the runs of a permutation.
+type permutationRecorder struct {
+	// Labels before and after the run, in the order of the legacy names.
+	before, after *metricsRecorder
+}
+
+// newPermutationRecorder labels the metrics of the node in the permutation.
+// It is called once per permutation, and run returns the recorder of every run.
+func (t *TestData) newPermutationRecorder(runenv *runtime.RunEnv, labels metricLabels) *permutationRecorder {
 	instance := runenv.TestInstanceCount
 	leechCount := runenv.IntParam("leech_count")
 	passiveCount := runenv.IntParam("passive_count")
+	p := labels.permutation
+	settings := labels.addSettings
+
+	mr := &metricsRecorder{
+		runenv: runenv,
+		legacy: runenv.IsParamSet("legacy_metrics") && runenv.BooleanParam("legacy_metrics"),
+	}
+	before := mr.withLabel("topology", fmt.Sprintf("(%d-%d-%d)", instance-leechCount-passiveCount, leechCount, passiveCount)).
+		withLabel("transport", labels.transport).
+		withLabel("maxConnectionRate", labels.maxConnectionRate).
+		withLabel("latencyMS", p.Latency.Milliseconds()).
+		withLabel("bandwidthMB", p.Bandwidth).
+		withLabel("lossPct", p.Impairments.LossPct).
+		withLabel("corruptPct", p.Impairments.CorruptPct).
+		withLabel("reorderPct", p.Impairments.ReorderPct).
+		withLabel("duplicatePct", p.Impairments.DuplicatePct)
+	after := mr.withLabel("seq", t.seq).
+		withLabel("groupName", runenv.TestGroupID).
+		withLabel("groupSeq", t.grpseq).
+		withLabel("fileSize", p.File.Size()).
+		withLabel("nodeType", t.nodetp).
+		withLabel("nodeTypeIndex", t.tpindex).
+		withLabel("layout", settings.Layout).
+		withLabel("chunker", settings.Chunker).
+		withLabel("rawLeaves", settings.RawLeaves).
+		withLabel("hashFunc", settings.HashFunc).
+		withLabel("maxLinks", settings.MaxLinks).
+		withLabel("cidVersion", settings.CidVersion)
+	return &permutationRecorder{before, after}
+}
 
-	id := fmt.Sprintf("topology:(%d-%d-%d)/transport:%s/maxConnectionRate:%d/latencyMS:%d/bandwidthMB:%d/run:%d/seq:%d/groupName:%s/groupSeq:%d/fileSize:%d/nodeType:%s/nodeTypeIndex:%d",
-		instance-leechCount-passiveCount, leechCount, passiveCount, transport, maxConnectionRate,
-		latencyMS, bandwidthMB, runNum, seq, runenv.TestGroupID, grpseq, fileSize, nodetp, tpindex)
+// run returns the recorder of the metrics of a run.
+func (pr *permutationRecorder) run(runNum int) *metricsRecorder {
+	mr := pr.before.withLabel("run", runNum)
+	for _, l := range pr.after.labels {
+		mr = mr.withLabel(l.key, l.value)
+	}
+	return mr
+}
 
-	return &metricsRecorder{runenv, id}
+// withLabel returns a recorder for the same metrics with an additional label.
+func (mr *metricsRecorder) withLabel(key string, value interface{}) *metricsRecorder {
+	labels := append(mr.labels[:len(mr.labels):len(mr.labels)], metricLabel{key, fmt.Sprint(value)})
+	return &metricsRecorder{mr.runenv, labels, mr.legacy}
 }
 
+// tagEscaper replaces the separators of Testground tags in label values.
+var tagEscaper = strings.NewReplacer(",", "_", "=", "_")
+
 func (mr *metricsRecorder) Record(key string, value float64) {
-	mr.runenv.R().RecordPoint(fmt.Sprintf("%s/name:%s", mr.id, key), value)
+	var name strings.Builder
+	if mr.legacy {
+		for _, l := range mr.labels {
+			fmt.Fprintf(&name, "%s:%s/", l.key, l.value)
+		}
+		fmt.Fprintf(&name, "name:%s", key)
+	} else {
+		name.WriteString(key)
+		for _, l := range mr.labels {
+			fmt.Fprintf(&name, ",%s=%s", l.key, tagEscaper.Replace(l.value))
+		}
+	}
+	mr.runenv.R().RecordPoint(name.String(), value)
 }
@@ -0,0 +1,196 @@
+package test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	files "github.com/ipfs/go-ipfs-files"
+	mdtest "github.com/ipfs/go-merkledag/test"
+	"github.com/testground/sdk-go/runtime"
+
+	"github.com/protocol/beyond-bitswap/testbed/testbed/utils"
+)
+
+// newTestRunEnv returns a run environment with the parameters, writing its
+// outputs to a temporary directory.
+func newTestRunEnv(t *testing.T, params map[string]string) *runtime.RunEnv {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "outputs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	runenv := runtime.NewRunEnv(runtime.RunParams{
+		TestPlan:           "testbed",
+		TestCase:           "transfer",
+		TestInstanceCount:  1,
+		TestInstanceParams: params,
+		TestOutputsPath:    dir,
+	})
+	t.Cleanup(func() {
+		runenv.Close()
+		os.RemoveAll(dir)
+	})
+	return runenv
+}
+
+func TestFractionalDAG(t *testing.T) {
+	// 10 leaves of 1KiB under the root.
+	const leaves = 10
+	settings := utils.DefaultAddSettings
+	settings.Chunker = "size-1024"
+
+	cases := []struct {
+		name        string
+		fraction    string
+		seedIndex   int
+		numerator   int
+		denominator int
+		invalid     bool
+		keepAll     bool
+	}{
+		{name: "unset", keepAll: true},
+		{name: "empty", fraction: "", keepAll: true},
+		{name: "half", fraction: "1/2", numerator: 1, denominator: 2},
+		{name: "other half", fraction: "1/2", seedIndex: 1, numerator: 1, denominator: 2},
+		{name: "three quarters", fraction: "3/4", seedIndex: 2, numerator: 3, denominator: 4},
+		{name: "whole", fraction: "1/1", numerator: 1, denominator: 1},
+		{name: "no denominator", fraction: "1", invalid: true},
+		{name: "not a number", fraction: "a/2", invalid: true},
+	}
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			params := map[string]string{}
+			if tt.name != "unset" {
+				params["seed_fraction"] = tt.fraction
+			}
+			runenv := newTestRunEnv(t, params)
+
+			dserv := mdtest.Mock()
+			adder, err := utils.NewDAGAdder(ctx, dserv, settings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := ioutil.ReadAll(utils.SeededRandReader(leaves*1024, 1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			root, err := adder.Add(files.NewBytesFile(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(root.Links()) != leaves {
+				t.Fatalf("root has %d links, expected %d", len(root.Links()), leaves)
+			}
+
+			err = fractionalDAG(ctx, runenv, tt.seedIndex, root.Cid(), dserv)
+			if tt.invalid {
+				if err == nil {
+					t.Fatalf("expected an error for seed fraction %q", tt.fraction)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The root is always kept.
+			if _, err := dserv.Get(ctx, root.Cid()); err != nil {
+				t.Fatalf("root was removed: %v", err)
+			}
+			for i, l := range root.Links() {
+				keep := tt.keepAll || (i+tt.seedIndex)%tt.denominator < tt.numerator
+				_, err := dserv.Get(ctx, l.Cid)
+				switch {
+				case keep && err != nil:
+					t.Errorf("leaf %d was removed: %v", i, err)
+				case !keep && err == nil:
+					t.Errorf("leaf %d was kept", i)
+				}
+			}
+		})
+	}
+}
+
+func TestGetPctParam(t *testing.T) {
+	cases := []struct {
+		value    string
+		expected []float64
+		invalid  bool
+	}{
+		{value: "0", expected: []float64{0}},
+		{value: "0,0.5,100", expected: []float64{0, 0.5, 100}},
+		{value: "0,a", invalid: true},
+		{value: "101", invalid: true},
+		{value: "0,-1", invalid: true},
+	}
+	for _, tt := range cases {
+		runenv := newTestRunEnv(t, map[string]string{"loss_pct": tt.value})
+		pcts, err := getPctParam(runenv, "loss_pct")
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("getPctParam(%q): expected an error, got %v", tt.value, pcts)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("getPctParam(%q): %v", tt.value, err)
+		} else if !reflect.DeepEqual(pcts, tt.expected) {
+			t.Errorf("getPctParam(%q) = %v, expected %v", tt.value, pcts, tt.expected)
+		}
+	}
+
+	// Unset percentages default to 0.
+	if pcts, err := getPctParam(newTestRunEnv(t, nil), "loss_pct"); err != nil || !reflect.DeepEqual(pcts, []float64{0}) {
+		t.Errorf("getPctParam of an unset param = %v, %v, expected [0]", pcts, err)
+	}
+}
+
+// sizedFile is a test file of which only the size is used.
+type sizedFile int64
+
+func (f sizedFile) GenerateFile() (files.Node, error) {
+	return files.NewBytesFile(make([]byte, f)), nil
+}
+
+func (f sizedFile) Size() int64 {
+	return int64(f)
+}
+
+func TestPermutationRecorder(t *testing.T) {
+	runenv := newTestRunEnv(t, map[string]string{"leech_count": "2", "passive_count": "0"})
+	td := &TestData{seq: 3, grpseq: 3, nodetp: utils.Leech, tpindex: 1}
+	recorder := td.newPermutationRecorder(runenv, metricLabels{
+		transport:         "bitswap",
+		permutation:       TestPermutation{File: sizedFile(1024), Bandwidth: 100, Latency: 50 * time.Millisecond},
+		maxConnectionRate: 100,
+		addSettings:       utils.DefaultAddSettings,
+	})
+
+	for _, run := range []int{1, 2} {
+		var keys []string
+		labels := make(map[string]string)
+		for _, l := range recorder.run(run).labels {
+			keys = append(keys, l.key)
+			labels[l.key] = l.value
+		}
+		// Labels keep the order of the legacy names.
+		expected := []string{"topology", "transport", "maxConnectionRate", "latencyMS", "bandwidthMB",
+			"lossPct", "corruptPct", "reorderPct", "duplicatePct", "run", "seq", "groupName", "groupSeq",
+			"fileSize", "nodeType", "nodeTypeIndex", "layout", "chunker", "rawLeaves", "hashFunc",
+			"maxLinks", "cidVersion"}
+		if !reflect.DeepEqual(keys, expected) {
+			t.Fatalf("got labels %v, expected %v", keys, expected)
+		}
+		if labels["run"] != strconv.Itoa(run) || labels["latencyMS"] != "50" ||
+			labels["fileSize"] != "1024" || labels["nodeType"] != "Leech" || labels["seq"] != "3" {
+			t.Errorf("unexpected labels of run %d: %v", run, labels)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package test
+
+import (
+	"context"
+
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/crypto"
+	"github.com/libp2p/go-libp2p-core/host"
+	ma "github.com/multiformats/go-multiaddr"
+	"github.com/testground/sdk-go/network"
+	"github.com/testground/sdk-go/runtime"
+	"github.com/testground/sdk-go/sync"
+
+	"github.com/protocol/beyond-bitswap/testbed/testbed/utils"
+)
+
+// HostConstructor creates the libp2p host of a node listening on the addresses.
+type HostConstructor func(ctx context.Context, privKey crypto.PrivKey, addrs []ma.Multiaddr, opts ...libp2p.Option) (host.Host, error)
+
+// Env is what a test instance needs besides its parameters and outputs (the
+// runtime.RunEnv): a sync service to coordinate with the other instances, a
+// client to shape its links and a way to create its host. Instances run by
+// Testground use the sync service and the sidecar, while the local package
+// runs all the instances in one process.
+type Env struct {
+	Sync    sync.Client
+	Network utils.NetworkClient
+	NewHost HostConstructor
+}
+
+// NewTestgroundEnv returns the environment of an instance run by Testground.
+func NewTestgroundEnv(ctx context.Context, runenv *runtime.RunEnv) *Env {
+	client := sync.MustBoundClient(ctx, runenv)
+	return &Env{
+		Sync:    client,
+		Network: network.NewClient(client, runenv),
+		NewHost: newLibp2pHost,
+	}
+}
+
+func newLibp2pHost(ctx context.Context, privKey crypto.PrivKey, addrs []ma.Multiaddr, opts ...libp2p.Option) (host.Host, error) {
+	opts = append([]libp2p.Option{libp2p.Identity(privKey), libp2p.ListenAddrs(addrs...)}, opts...)
+	return libp2p.New(ctx, opts...)
+}
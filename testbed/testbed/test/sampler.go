@@ -0,0 +1,151 @@
+package test
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/protocol/beyond-bitswap/testbed/testbed/utils"
+)
+
+// progressSample is a snapshot of a fetch in progress.
+type progressSample struct {
+	// Nominal time of the sample since the fetch started: the interval times
+	// the sample number, rounded up for the last sample.
+	offset time.Duration
+	// Measured time since the fetch started.
+	elapsed     time.Duration
+	bytesRcvd   uint64
+	blocksRcvd  uint64
+	activePeers int
+}
+
+// progressSampler samples the data received by a node at a fixed interval
+// while it fetches a file.
+type progressSampler struct {
+	cancel  context.CancelFunc
+	done    chan struct{}
+	samples []progressSample
+}
+
+// startSampler starts sampling the node every interval. Counters are relative
+// to the start of the sampling.
+func startSampler(ctx context.Context, node utils.Node, interval time.Duration) *progressSampler {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &progressSampler{cancel: cancel, done: make(chan struct{})}
+	start := time.Now()
+	base := node.Progress()
+
+	sample := func() {
+		p := node.Progress()
+		s.samples = append(s.samples, progressSample{
+			offset:      time.Duration(len(s.samples)+1) * interval,
+			elapsed:     time.Since(start),
+			bytesRcvd:   p.BytesRcvd - base.BytesRcvd,
+			blocksRcvd:  p.BlocksRcvd - base.BlocksRcvd,
+			activePeers: len(node.Host().Network().Peers()),
+		})
+	}
+
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				sample()
+			case <-ctx.Done():
+				// Last sample at the end of the fetch.
+				sample()
+				return
+			}
+		}
+	}()
+	return s
+}
+
+// stop stops sampling and returns the samples.
+func (s *progressSampler) stop() []progressSample {
+	s.cancel()
+	<-s.done
+	return s.samples
+}
+
+// emitSamples records every sample labeled with its nominal time, so that
+// samples line up across leeches and runs, along with the measured time.
+func emitSamples(mr *metricsRecorder, samples []progressSample) {
+	for _, s := range samples {
+		recorder := mr.withLabel("sampleMS", s.offset.Milliseconds())
+		recorder.Record("sample_elapsed", float64(s.elapsed))
+		recorder.Record("sample_bytes_rcvd", float64(s.bytesRcvd))
+		recorder.Record("sample_blocks_rcvd", float64(s.blocksRcvd))
+		recorder.Record("sample_active_peers", float64(s.activePeers))
+	}
+}
+
+// blockArrivals records when the blocks of a fetch arrive, relative to the
+// start of the request.
+type blockArrivals struct {
+	lk       sync.Mutex
+	start    time.Time
+	root     cid.Cid
+	seen     map[cid.Cid]bool
+	arrivals []time.Duration
+	toRoot   time.Duration
+}
+
+func newBlockArrivals(root cid.Cid) *blockArrivals {
+	return &blockArrivals{start: time.Now(), root: root, seen: make(map[cid.Cid]bool)}
+}
+
+// hook is set as the block hook of the node while fetching.
+func (a *blockArrivals) hook(c cid.Cid, size int) {
+	elapsed := time.Since(a.start)
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	if c.Defined() {
+		// Blocks may be notified more than once.
+		if a.seen[c] {
+			return
+		}
+		a.seen[c] = true
+		if c.Equals(a.root) {
+			a.toRoot = elapsed
+		}
+	}
+	a.arrivals = append(a.arrivals, elapsed)
+}
+
+// emit records the time to the first block, the time to the root block (only
+// for nodes exchanging blocks) and a histogram of arrival times with
+// power-of-two millisecond buckets labeled with their upper bound.
+func (a *blockArrivals) emit(mr *metricsRecorder) {
+	a.lk.Lock()
+	defer a.lk.Unlock()
+	if len(a.arrivals) == 0 {
+		return
+	}
+	mr.Record("time_to_first_block", float64(a.arrivals[0]))
+	if a.toRoot > 0 {
+		mr.Record("time_to_root", float64(a.toRoot))
+	}
+
+	var buckets []int
+	var bounds []int64
+	for _, t := range a.arrivals {
+		bucket := 0
+		for bound := int64(1); t.Milliseconds() >= bound; bound *= 2 {
+			bucket++
+		}
+		for len(buckets) <= bucket {
+			buckets = append(buckets, 0)
+			bounds = append(bounds, int64(1)<<len(bounds))
+		}
+		buckets[bucket]++
+	}
+	for i, count := range buckets {
+		mr.withLabel("arrivalMS", bounds[i]).Record("block_arrivals", float64(count))
+	}
+}
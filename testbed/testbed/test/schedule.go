@@ -0,0 +1,255 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	gosync "sync"
+	"time"
+
+	"github.com/protocol/beyond-bitswap/testbed/testbed/utils"
+	"github.com/testground/sdk-go/network"
+	"github.com/testground/sdk-go/runtime"
+	"github.com/testground/sdk-go/sync"
+)
+
+// Interval to check whether a fetch resumed after healing a partition.
+const resumePollInterval = 10 * time.Millisecond
+
+// networkEvent is a change of the links of a node: a step of the network
+// schedule, a partition or its healing.
+type networkEvent struct {
+	at        time.Duration
+	step      int
+	partition int
+	heal      bool
+}
+
+// networkMarker records when a network event was applied.
+type networkMarker struct {
+	event   networkEvent
+	elapsed time.Duration
+}
+
+// partitionResume records whether a leech fetch resumed after a partition healed.
+type partitionResume struct {
+	partition int
+	healed    time.Time
+	resumed   time.Time
+}
+
+// networkReport holds what happened to the network of a node during a run.
+type networkReport struct {
+	markers []networkMarker
+	resumes []partitionResume
+}
+
+// networkScheduler applies the network schedule and the partitions to the
+// links of a node while the leeches fetch.
+type networkScheduler struct {
+	runenv     *runtime.RunEnv
+	t          *NodeTestData
+	base       *network.Config
+	steps      []utils.NetworkStep
+	partitions []utils.Partition
+	state      string
+	cancel     context.CancelFunc
+	done       chan struct{}
+	watchers   gosync.WaitGroup
+
+	lk      gosync.Mutex
+	report  networkReport
+	applied bool
+}
+
+// startNetworkSchedule applies every event at its time since now. Without a
+// sidecar there are no links to change and it returns nil.
+func startNetworkSchedule(ctx context.Context, runenv *runtime.RunEnv, t *NodeTestData, base *network.Config,
+	testvars *TestVars, state string) *networkScheduler {
+	if len(testvars.NetworkSchedule) == 0 && len(testvars.Partitions) == 0 {
+		return nil
+	}
+	if base == nil {
+		runenv.RecordMessage("No sidecar, ignoring the network schedule and partitions")
+		return nil
+	}
+
+	var events []networkEvent
+	for i, s := range testvars.NetworkSchedule {
+		events = append(events, networkEvent{at: time.Duration(s.AtMS) * time.Millisecond, step: i, partition: -1})
+	}
+	for i, p := range testvars.Partitions {
+		events = append(events, networkEvent{at: time.Duration(p.AtMS) * time.Millisecond, step: -1, partition: i})
+		if p.HealMS > 0 {
+			events = append(events, networkEvent{at: time.Duration(p.HealMS) * time.Millisecond, step: -1, partition: i, heal: true})
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].at < events[j].at })
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &networkScheduler{
+		runenv:     runenv,
+		t:          t,
+		base:       base,
+		steps:      testvars.NetworkSchedule,
+		partitions: testvars.Partitions,
+		state:      state,
+		cancel:     cancel,
+		done:       make(chan struct{}),
+	}
+	go s.run(ctx, events)
+	return s
+}
+
+func (s *networkScheduler) run(ctx context.Context, events []networkEvent) {
+	defer close(s.done)
+	start := time.Now()
+	// Steps are applied in order, partitions while active.
+	applied := 0
+	active := make([]bool, len(s.partitions))
+	for i, e := range events {
+		select {
+		case <-time.After(time.Until(start.Add(e.at))):
+		case <-ctx.Done():
+			return
+		}
+		if e.step >= 0 {
+			applied = e.step + 1
+		} else {
+			active[e.partition] = !e.heal
+		}
+
+		cfg, err := s.config(applied, active)
+		if err == nil {
+			// Only this instance waits for its own callback.
+			cfg.CallbackState = sync.State(fmt.Sprintf("%s-%d", s.state, i))
+			cfg.CallbackTarget = 1
+			err = s.t.nwClient.ConfigureNetwork(ctx, cfg)
+		}
+		if err != nil {
+			s.runenv.RecordMessage("Error applying network change %d: %v", i, err)
+			return
+		}
+		elapsed := time.Since(start)
+
+		switch {
+		case e.step >= 0:
+			s.runenv.RecordMessage("Applied network step %d after %s: %s", e.step, elapsed, s.steps[e.step])
+		case e.heal:
+			s.runenv.RecordMessage("Healed partition %d after %s", e.partition, elapsed)
+			if s.t.nodetp == utils.Leech {
+				s.watchResume(ctx, e.partition)
+			}
+		default:
+			s.runenv.RecordMessage("Applied partition %d after %s (partitioned: %t)", e.partition, elapsed,
+				s.partitions[e.partition].Contains(s.t.selfInfo()))
+		}
+		s.lk.Lock()
+		s.applied = true
+		s.report.markers = append(s.report.markers, networkMarker{event: e, elapsed: elapsed})
+		s.lk.Unlock()
+	}
+}
+
+// config returns the base config with the first steps and the active
+// partitions applied.
+func (s *networkScheduler) config(steps int, active []bool) (*network.Config, error) {
+	cfg := s.base
+	for _, step := range s.steps[:steps] {
+		cfg = step.Apply(cfg)
+	}
+	for i, p := range s.partitions {
+		if !active[i] {
+			continue
+		}
+		var err error
+		cfg, err = p.Apply(cfg, s.t.selfInfo(), s.t.peerInfos)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Never modify the base config.
+	next := *cfg
+	return &next, nil
+}
+
+// watchResume records when the leech receives data again after healing the
+// partition.
+func (s *networkScheduler) watchResume(ctx context.Context, partition int) {
+	healed := time.Now()
+	base := s.t.node.Progress().BytesRcvd
+	s.watchers.Add(1)
+	go func() {
+		defer s.watchers.Done()
+		ticker := time.NewTicker(resumePollInterval)
+		defer ticker.Stop()
+		r := partitionResume{partition: partition, healed: healed}
+		defer func() {
+			s.lk.Lock()
+			s.report.resumes = append(s.report.resumes, r)
+			s.lk.Unlock()
+		}()
+		for {
+			select {
+			case <-ticker.C:
+				if s.t.node.Progress().BytesRcvd > base {
+					r.resumed = time.Now()
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// stop stops applying events, restores the original links if they changed and
+// returns the report of the run.
+func (s *networkScheduler) stop(ctx context.Context) (networkReport, error) {
+	if s == nil {
+		return networkReport{}, nil
+	}
+	s.cancel()
+	<-s.done
+	s.watchers.Wait()
+	if !s.applied {
+		return s.report, nil
+	}
+	restore := *s.base
+	restore.CallbackState = sync.State(s.state + "-restore")
+	restore.CallbackTarget = 1
+	if err := s.t.nwClient.ConfigureNetwork(ctx, &restore); err != nil {
+		return networkReport{}, fmt.Errorf("Failed to restore network: %w", err)
+	}
+	return s.report, nil
+}
+
+// emit records the time since the start of the transfer of every network
+// event applied, labeled with the index of the step or partition. For leeches
+// still fetching when a partition healed, it also records whether the fetch
+// resumed and how long it took.
+func (r networkReport) emit(mr *metricsRecorder, fetchEnd time.Time) {
+	for _, m := range r.markers {
+		switch {
+		case m.event.step >= 0:
+			mr.withLabel("step", m.event.step).Record("network_step_ms", float64(m.elapsed.Milliseconds()))
+		case m.event.heal:
+			mr.withLabel("partition", m.event.partition).Record("heal_ms", float64(m.elapsed.Milliseconds()))
+		default:
+			mr.withLabel("partition", m.event.partition).Record("partition_ms", float64(m.elapsed.Milliseconds()))
+		}
+	}
+	for _, res := range r.resumes {
+		if !fetchEnd.IsZero() && fetchEnd.Before(res.healed) {
+			// The fetch didn't wait for the healing.
+			continue
+		}
+		recorder := mr.withLabel("partition", res.partition)
+		if res.resumed.IsZero() {
+			recorder.Record("fetch_resumed", 0)
+			continue
+		}
+		recorder.Record("fetch_resumed", 1)
+		recorder.Record("time_to_resume", float64(res.resumed.Sub(res.healed)))
+	}
+}
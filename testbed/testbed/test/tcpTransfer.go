@@ -21,7 +21,9 @@ func TCPTransfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 	/// --- Set up
 	ctx, cancel := context.WithTimeout(context.Background(), testvars.Timeout)
 	defer cancel()
-	t, err := InitializeTest(ctx, runenv, testvars)
+	env := NewTestgroundEnv(ctx, runenv)
+	defer env.Sync.Close()
+	t, err := InitializeTest(ctx, runenv, env, testvars)
 	if err != nil {
 		return err
 	}
@@ -40,8 +42,8 @@ func TCPTransfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 	// For each file found in the test
 	for pIndex, testParams := range testvars.Permutations {
 		// Set up network (with traffic shaping)
-		if err := utils.SetupNetwork(ctx, runenv, t.nwClient, t.nodetp, t.tpindex, testParams.Latency,
-			testParams.Bandwidth, testParams.JitterPct); err != nil {
+		if _, err := utils.SetupNetwork(ctx, runenv, t.nwClient, t.nodetp, t.tpindex, testParams.Latency,
+			testParams.Bandwidth, testParams.JitterPct, testParams.Impairments, t.selfInfo(), t.peerInfos); err != nil {
 			return fmt.Errorf("Failed to set up network: %v", err)
 		}
 
@@ -51,6 +53,12 @@ func TCPTransfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 		}
 
 		runenv.RecordMessage("Starting TCP Fetch...")
+		recorder := t.newPermutationRecorder(runenv, metricLabels{
+			transport:         "tcp",
+			permutation:       testParams,
+			maxConnectionRate: 1,
+			addSettings:       testvars.AddSettings,
+		})
 
 		for runNum := 1; runNum < testvars.RunCount+1; runNum++ {
 
@@ -65,9 +73,7 @@ func TCPTransfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 				if err != nil {
 					return err
 				}
-				recorder := newMetricsRecorder(runenv, runNum, t.seq, t.grpseq, "tcp", testParams.Latency,
-					testParams.Bandwidth, int(testParams.File.Size()), t.nodetp, t.tpindex, 1)
-				recorder.Record("time_to_fetch", float64(tcpFetch))
+				recorder.run(runNum).Record("time_to_fetch", float64(tcpFetch))
 			}
 		}
 
@@ -2,7 +2,6 @@ package test
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"strconv"
 	"time"
@@ -10,6 +9,7 @@ import (
 	"github.com/libp2p/go-libp2p"
 	"github.com/libp2p/go-libp2p-core/crypto"
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/metrics"
 	"github.com/testground/sdk-go/run"
 	"github.com/testground/sdk-go/runtime"
 	"github.com/testground/sdk-go/sync"
@@ -21,6 +21,15 @@ import (
 
 // Transfer data from S seeds to L leeches
 func Transfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	env := NewTestgroundEnv(ctx, runenv)
+	defer env.Sync.Close()
+	return RunTransfer(runenv, env)
+}
+
+// RunTransfer runs the transfer test case in the environment.
+func RunTransfer(runenv *runtime.RunEnv, env *Env) error {
 	// Test Parameters
 	testvars, err := getEnvVars(runenv)
 	if err != nil {
@@ -31,7 +40,7 @@ func Transfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 	/// --- Set up
 	ctx, cancel := context.WithTimeout(context.Background(), testvars.Timeout)
 	defer cancel()
-	baseT, err := InitializeTest(ctx, runenv, testvars)
+	baseT, err := InitializeTest(ctx, runenv, env, testvars)
 	if err != nil {
 		return err
 	}
@@ -51,14 +60,17 @@ func Transfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 	// For each test permutation found in the test
 	for pIndex, testParams := range testvars.Permutations {
 		// Set up network (with traffic shaping)
-		if err := utils.SetupNetwork(ctx, runenv, t.nwClient, t.nodetp, t.tpindex, testParams.Latency,
-			testParams.Bandwidth, testParams.JitterPct); err != nil {
+		netCfg, err := utils.SetupNetwork(ctx, runenv, t.nwClient, t.nodetp, t.tpindex, testParams.Latency,
+			testParams.Bandwidth, testParams.JitterPct, testParams.Impairments, t.selfInfo(), t.peerInfos)
+		if err != nil {
 			return fmt.Errorf("Failed to set up network: %v", err)
 		}
 
 		// Accounts for every file that couldn't be found.
 		var leechFails int64
 		var rootCid cid.Cid
+		// Items of the catalog, starting with the root CID, in catalog workloads.
+		var catalog []cid.Cid
 
 		// Wait for all nodes to be ready to start the run
 		err = signalAndWaitForAll(fmt.Sprintf("start-file-%d", pIndex))
@@ -66,15 +78,23 @@ func Transfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 			return err
 		}
 
-		switch t.nodetp {
-		case utils.Seed:
+		switch {
+		case t.nodetp == utils.Seed && testvars.Catalog.enabled():
+			catalog, err = t.addPublishCatalog(ctx, pIndex, testParams.File, runenv, testvars)
+		case t.nodetp == utils.Leech && testvars.Catalog.enabled():
+			catalog, err = t.readCatalog(ctx, pIndex, runenv, testvars)
+		case t.nodetp == utils.Seed:
 			rootCid, err = t.addPublishFile(ctx, pIndex, testParams.File, runenv, testvars)
-		case utils.Leech:
+		case t.nodetp == utils.Leech:
 			rootCid, err = t.readFile(ctx, pIndex, runenv, testvars)
 		}
 		if err != nil {
 			return err
 		}
+		roots := []cid.Cid{rootCid}
+		if len(catalog) > 0 {
+			rootCid, roots = catalog[0], catalog
+		}
 
 		runenv.RecordMessage("File injest complete...")
 		// Wait for all nodes to be ready to dial
@@ -97,6 +117,12 @@ func Transfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 		}
 
 		runenv.RecordMessage("Starting %s Fetch...", nodeType)
+		recorder := t.newPermutationRecorder(runenv, metricLabels{
+			transport:         nodeType,
+			permutation:       testParams,
+			maxConnectionRate: testvars.MaxConnectionRate,
+			addSettings:       testvars.AddSettings,
+		})
 
 		for runNum := 1; runNum < testvars.RunCount+1; runNum++ {
 			// Reset the timeout for each run
@@ -126,9 +152,100 @@ func Transfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 			}
 
 			/// --- Start test
+			transferStart := time.Now()
+
+			// Change the links of every node while the leeches fetch.
+			scheduler := startNetworkSchedule(ctx, runenv, t, netCfg, testvars,
+				fmt.Sprintf("network-schedule-%s-%d", runID, t.seq))
+			var churn *churner
+			if testvars.Churn.enabled() {
+				e, err := t.getChurnEvent(ctx, runenv, runID, testvars.Churn)
+				if err != nil {
+					return err
+				}
+				churn = startChurn(ctx, runenv, transferNode.Host(), testvars.Churn.Mode, e)
+			}
 
 			var timeToFetch time.Duration
-			if t.nodetp == utils.Leech {
+			// Only set to false if some fetched content doesn't match the seeds' original.
+			verifyOK := true
+			var samples []progressSample
+			var arrivals *blockArrivals
+			// When the last successful fetch ended.
+			var fetchEnd time.Time
+			var arrival *leechArrival
+			var requests []catalogRequest
+
+			// fetch fetches the file from the peers and returns the path of the
+			// fetched file, or an empty path if the fetch failed.
+			fetch := func(peers []utils.PeerInfo, label string) string {
+				runenv.RecordMessage("Starting to leech %d / %d (%d bytes)", runNum, testvars.RunCount, testParams.File.Size())
+				start := time.Now()
+				// Block arrivals are relative to a single root, so they aren't
+				// tracked for the concurrent requests of catalog workloads.
+				if !testvars.Catalog.enabled() {
+					arrivals = newBlockArrivals(rootCid)
+					transferNode.SetBlockHook(arrivals.hook)
+					defer transferNode.SetBlockHook(nil)
+				}
+				// TODO: Here we may be able to define requesting pattern. ipfs.DAG()
+				// Right now using a path.
+				ctxFetch, cancel := context.WithTimeout(ctx, testvars.RunTimeout/2)
+				defer cancel()
+				// Pin Add also traverse the whole DAG
+				// err := ipfsNode.API.Pin().Add(ctxFetch, fPath)
+				var sampler *progressSampler
+				if testvars.SampleInterval > 0 {
+					sampler = startSampler(ctxFetch, transferNode, testvars.SampleInterval)
+				}
+				if sampler != nil {
+					// Stream-based nodes receive the data while writing the file.
+					defer func() { samples = sampler.stop() }()
+				}
+				if testvars.Catalog.enabled() {
+					requests = t.fetchCatalog(ctxFetch, runenv, catalog, peers, testvars)
+					for _, r := range requests {
+						if !r.ok {
+							leechFails++
+							verifyOK = false
+						}
+					}
+					timeToFetch = time.Since(start)
+					fetchEnd = time.Now()
+					runenv.RecordMessage("Leech fetch of %d catalog items complete (%d ns) for %s", len(requests), timeToFetch, label)
+					// Leeches only serve single files.
+					return ""
+				}
+				rcvFile, err := transferNode.Fetch(ctxFetch, rootCid, peers)
+				if err != nil {
+					runenv.RecordMessage("Error fetching data: %v", err)
+					leechFails++
+					verifyOK = false
+					return ""
+				}
+				runenv.RecordMessage("Fetch complete, proceeding")
+				fetchPath := "/tmp/" + strconv.Itoa(t.tpindex) + time.Now().String()
+				err = files.WriteTo(rcvFile, fetchPath)
+				if err != nil {
+					// Streams truncated or reset by the seed fail here.
+					runenv.RecordMessage("Error writing fetched data: %v", err)
+					leechFails++
+					verifyOK = false
+					return ""
+				}
+				timeToFetch = time.Since(start)
+				fetchEnd = time.Now()
+				s, _ := rcvFile.Size()
+				runenv.RecordMessage("Leech fetch of %d complete (%d ns) for %s", s, timeToFetch, label)
+				if err := utils.VerifyFile(ctx, transferNode, rootCid, fetchPath, testvars.AddSettings); err != nil {
+					runenv.RecordMessage("Verification of fetched data failed: %v", err)
+					verifyOK = false
+					return ""
+				}
+				return fetchPath
+			}
+
+			if t.nodetp == utils.Leech && testvars.Arrivals.Process == ArrivalWaves {
 				// For each wave
 				for waveNum := 0; waveNum < testvars.NumWaves; waveNum++ {
 					// Only leecheers for that wave entitled to leech.
@@ -138,30 +255,8 @@ func Transfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 						// Note: seq starts from 1 (not 0)
 						startDelay := time.Duration(t.seq-1) * testvars.RequestStagger
 
-						runenv.RecordMessage("Starting to leech %d / %d (%d bytes)", runNum, testvars.RunCount, testParams.File.Size())
 						runenv.RecordMessage("Leech fetching data after %s delay", startDelay)
-						start := time.Now()
-						// TODO: Here we may be able to define requesting pattern. ipfs.DAG()
-						// Right now using a path.
-						ctxFetch, cancel := context.WithTimeout(ctx, testvars.RunTimeout/2)
-						// Pin Add also traverse the whole DAG
-						// err := ipfsNode.API.Pin().Add(ctxFetch, fPath)
-						rcvFile, err := transferNode.Fetch(ctxFetch, rootCid, t.peerInfos)
-						if err != nil {
-							runenv.RecordMessage("Error fetching data: %v", err)
-							leechFails++
-						} else {
-							runenv.RecordMessage("Fetch complete, proceeding")
-							err = files.WriteTo(rcvFile, "/tmp/"+strconv.Itoa(t.tpindex)+time.Now().String())
-							if err != nil {
-								cancel()
-								return err
-							}
-							timeToFetch = time.Since(start)
-							s, _ := rcvFile.Size()
-							runenv.RecordMessage("Leech fetch of %d complete (%d ns) for wave %d", s, timeToFetch, waveNum)
-						}
-						cancel()
+						fetch(t.peerInfos, fmt.Sprintf("wave %d", waveNum))
 					}
 					if waveNum < testvars.NumWaves-1 {
 						runenv.RecordMessage("Waiting 5 seconds between waves for wave %d", waveNum)
@@ -169,6 +264,18 @@ func Transfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 					}
 					_, err = t.client.SignalAndWait(ctx, sync.State(fmt.Sprintf("leech-wave-%d", waveNum)), testvars.LeechCount)
 				}
+			} else if t.nodetp == utils.Leech {
+				// Leeches arrive following the arrival process.
+				arrival, err = t.arrive(ctx, runenv, runID, transferStart, testvars)
+				if err != nil {
+					return err
+				}
+				fetchPath := fetch(arrival.peers, fmt.Sprintf("arrival after %s", arrival.at))
+				if fetchPath != "" && testvars.Arrivals.LeechBecomesSeed {
+					if err := t.becomeSeed(ctx, runenv, runID, fetchPath); err != nil {
+						return err
+					}
+				}
 			}
 
 			// Wait for all leeches to have downloaded the data from seeds
@@ -176,20 +283,37 @@ func Transfer(runenv *runtime.RunEnv, initCtx *run.InitContext) error {
 			if err != nil {
 				return err
 			}
+			netReport, err := scheduler.stop(ctx)
+			if err != nil {
+				return err
+			}
+			churn.stop(ctx)
 
 			/// --- Report stats
-			err = t.emitMetrics(runenv, runNum, nodeType, testParams, timeToFetch, tcpFetch, leechFails, testvars.MaxConnectionRate)
+			err = t.emitMetrics(recorder.run(runNum), runResult{
+				timeToFetch: timeToFetch,
+				tcpFetch:    tcpFetch,
+				leechFails:  leechFails,
+				verifyOK:    verifyOK,
+				samples:     samples,
+				arrivals:    arrivals,
+				netReport:   netReport,
+				fetchEnd:    fetchEnd,
+				churn:       churn,
+				arrival:     arrival,
+				requests:    requests,
+			})
 			if err != nil {
 				return err
 			}
 			runenv.RecordMessage("Finishing emitting metrics. Starting to clean...")
 
-			err = t.cleanupRun(ctx, rootCid, runenv)
+			err = t.cleanupRun(ctx, roots, runenv)
 			if err != nil {
 				return err
 			}
 		}
-		err = t.cleanupFile(ctx, rootCid)
+		err = t.cleanupFile(ctx, roots)
 		if err != nil {
 			return err
 		}
@@ -211,8 +335,7 @@ var supportedNodes = map[string]nodeInitializer{
 	"graphsync":  initializeGraphsyncTest,
 	"libp2pHTTP": initializeLibp2pHTTPTest,
 	"rawLibp2p":  initializeRawLibp2pTest,
-	//TODO FIX HTTP
-	//"http":       initializeHTTPTest,
+	"http":       initializeHTTPTest,
 }
 
 func initializeIPFSTest(ctx context.Context, runenv *runtime.RunEnv, testvars *TestVars, baseT *TestData) (*NodeTestData, error) {
@@ -224,7 +347,7 @@ func initializeIPFSTest(ctx context.Context, runenv *runtime.RunEnv, testvars *T
 	if err != nil {
 		return nil, err
 	}
-	ipfsNode, err := utils.CreateIPFSNodeWithConfig(ctx, baseT.nConfig, exch, testvars.DHTEnabled, testvars.ProvidingEnabled)
+	ipfsNode, err := utils.CreateIPFSNodeWithConfig(ctx, baseT.nConfig, exch, testvars.DHTEnabled, testvars.ProvidingEnabled, testvars.AddSettings)
 	if err != nil {
 		runenv.RecordFailure(err)
 		return nil, err
@@ -261,7 +384,7 @@ func initializeBitswapTest(ctx context.Context, runenv *runtime.RunEnv, testvars
 		return nil, err
 	}
 	// Create a new bitswap node from the blockstore
-	bsnode, err := utils.CreateBitswapNode(ctx, h, bstore)
+	bsnode, err := utils.CreateBitswapNode(ctx, h, bstore, testvars.AddSettings)
 	if err != nil {
 		return nil, err
 	}
@@ -289,9 +412,8 @@ func initializeGraphsyncTest(ctx context.Context, runenv *runtime.RunEnv, testva
 		return nil, err
 	}
 
-	// Create a new bitswap node from the blockstore
-	numSeeds := runenv.TestInstanceCount - (testvars.LeechCount + testvars.PassiveCount)
-	bsnode, err := utils.CreateGraphsyncNode(ctx, h, bstore, numSeeds)
+	// Create a new graphsync node from the blockstore
+	bsnode, err := utils.CreateGraphsyncNode(ctx, h, bstore, testvars.AddSettings, testvars.ParallelFetch)
 	if err != nil {
 		return nil, err
 	}
@@ -300,25 +422,14 @@ func initializeGraphsyncTest(ctx context.Context, runenv *runtime.RunEnv, testva
 }
 
 func initializeLibp2pHTTPTest(ctx context.Context, runenv *runtime.RunEnv, testvars *TestVars, baseT *TestData) (*NodeTestData, error) {
-	if runenv.TestInstanceCount != 2 {
-		return nil, errors.New("libp2p HTTP transfer ONLY supports two instances for now")
-	}
-
-	if testvars.LeechCount != 1 {
-		return nil, errors.New("libp2p HTTP transfer ONLY supports 1 Leecher for now")
-	}
-
-	if testvars.PassiveCount != 0 {
-		return nil, errors.New("libp2p HTTP transfer does NOT support passive peers")
-	}
-
-	h, err := makeHost(ctx, baseT)
+	bwc := metrics.NewBandwidthCounter()
+	h, err := makeHost(ctx, baseT, libp2p.BandwidthReporter(bwc))
 	if err != nil {
 		return nil, err
 	}
 	runenv.RecordMessage("I am %s with addrs: %v", h.ID(), h.Addrs())
 
-	libp2pHttpN, err := utils.CreateLibp2pHTTPNode(ctx, h, baseT.nodetp)
+	libp2pHttpN, err := utils.CreateLibp2pHTTPNode(ctx, h, bwc, baseT.nodetp, testvars.ParallelFetch)
 	if err != nil {
 		return nil, err
 	}
@@ -331,25 +442,15 @@ func initializeLibp2pHTTPTest(ctx context.Context, runenv *runtime.RunEnv, testv
 }
 
 func initializeHTTPTest(ctx context.Context, runenv *runtime.RunEnv, testvars *TestVars, baseT *TestData) (*NodeTestData, error) {
-	if runenv.TestInstanceCount != 2 {
-		return nil, errors.New("http transfer ONLY supports two instances for now")
-	}
-
-	if testvars.LeechCount != 1 {
-		return nil, errors.New("http transfer ONLY supports 1 Leecher for now")
-	}
-
-	if testvars.PassiveCount != 0 {
-		return nil, errors.New("http transfer does NOT support passive peers")
-	}
-
 	h, err := makeHost(ctx, baseT)
 	if err != nil {
 		return nil, err
 	}
 	runenv.RecordMessage("I am %s with addrs: %v", h.ID(), h.Addrs())
 
-	httpN, err := utils.CreateHTTPNode(ctx, h, baseT.nodetp)
+	// Files are served over the data network.
+	ip := baseT.nwClient.MustGetDataNetworkIP().String()
+	httpN, err := utils.CreateHTTPNode(ctx, h, baseT.nodetp, ip, testvars.ParallelFetch)
 	if err != nil {
 		return nil, err
 	}
@@ -362,25 +463,14 @@ func initializeHTTPTest(ctx context.Context, runenv *runtime.RunEnv, testvars *T
 }
 
 func initializeRawLibp2pTest(ctx context.Context, runenv *runtime.RunEnv, testvars *TestVars, baseT *TestData) (*NodeTestData, error) {
-	if runenv.TestInstanceCount != 2 {
-		return nil, errors.New("libp2p transfer ONLY supports two instances for now")
-	}
-
-	if testvars.LeechCount != 1 {
-		return nil, errors.New("libp2p transfer ONLY supports 1 Leecher for now")
-	}
-
-	if testvars.PassiveCount != 0 {
-		return nil, errors.New("libp2P transfer does NOT support passive peers")
-	}
-
-	h, err := makeHost(ctx, baseT)
+	bwc := metrics.NewBandwidthCounter()
+	h, err := makeHost(ctx, baseT, libp2p.BandwidthReporter(bwc))
 	if err != nil {
 		return nil, err
 	}
 	runenv.RecordMessage("I am %s with addrs: %v", h.ID(), h.Addrs())
 
-	rawLibp2pN, err := utils.CreateRawLibp2pNode(ctx, h, baseT.nodetp)
+	rawLibp2pN, err := utils.CreateRawLibp2pNode(ctx, h, bwc, baseT.nodetp, testvars.ParallelFetch)
 	if err != nil {
 		return nil, err
 	}
@@ -392,12 +482,11 @@ func initializeRawLibp2pTest(ctx context.Context, runenv *runtime.RunEnv, testva
 	}, nil
 }
 
-func makeHost(ctx context.Context, baseT *TestData) (host.Host, error) {
+func makeHost(ctx context.Context, baseT *TestData, opts ...libp2p.Option) (host.Host, error) {
 	// Create libp2p node
 	privKey, err := crypto.UnmarshalPrivateKey(baseT.nConfig.PrivKey)
 	if err != nil {
 		return nil, err
 	}
-
-	return libp2p.New(ctx, libp2p.Identity(privKey), libp2p.ListenAddrs(baseT.nConfig.AddrInfo.Addrs...))
+	return baseT.newHost(ctx, privKey, baseT.nConfig.AddrInfo.Addrs, opts...)
 }
@@ -21,7 +21,6 @@ import (
 	ipld "github.com/ipfs/go-ipld-format"
 	"github.com/ipfs/go-merkledag"
 	unixfile "github.com/ipfs/go-unixfs/file"
-	"github.com/ipfs/go-unixfs/importer/helpers"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/pkg/errors"
 	"golang.org/x/sync/errgroup"
@@ -51,6 +50,8 @@ type BitswapNode struct {
 	blockStore blockstore.Blockstore
 	dserv      ipld.DAGService
 	h          host.Host
+	settings   AddSettings
+	hook       *blockHook
 }
 
 func (n *BitswapNode) Close() error {
@@ -110,28 +111,22 @@ func ClearBlockstore(ctx context.Context, bstore blockstore.Blockstore) error {
 	return g.Wait()
 }
 
-func CreateBitswapNode(ctx context.Context, h host.Host, bstore blockstore.Blockstore) (*BitswapNode, error) {
+func CreateBitswapNode(ctx context.Context, h host.Host, bstore blockstore.Blockstore, settings AddSettings) (*BitswapNode, error) {
 	routing, err := nilrouting.ConstructNilRouting(ctx, nil, nil, nil)
 	if err != nil {
 		return nil, err
 	}
 	net := bsnet.NewFromIpfsHost(h, routing)
-	bitswap := bs.New(ctx, net, bstore).(*bs.Bitswap)
+	// Bitswap puts the blocks it receives in the blockstore.
+	hook := &blockHook{}
+	bitswap := bs.New(ctx, net, &notifyBlockstore{bstore, hook}).(*bs.Bitswap)
 	bserv := blockservice.New(bstore, bitswap)
 	dserv := merkledag.NewDAGService(bserv)
-	return &BitswapNode{bitswap, bstore, dserv, h}, nil
+	return &BitswapNode{bitswap, bstore, dserv, h, settings, hook}, nil
 }
 
 func (n *BitswapNode) Add(ctx context.Context, fileNode files.Node) (cid.Cid, error) {
-	settings := AddSettings{
-		Layout:    "balanced",
-		Chunker:   "size-262144",
-		RawLeaves: false,
-		NoCopy:    false,
-		HashFunc:  "sha2-256",
-		MaxLinks:  helpers.DefaultLinksPerBlock,
-	}
-	adder, err := NewDAGAdder(ctx, n.dserv, settings)
+	adder, err := NewDAGAdder(ctx, n.dserv, n.settings)
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -163,6 +158,18 @@ func (n *BitswapNode) EmitMetrics(recorder MetricsRecorder) error {
 	return err
 }
 
+func (n *BitswapNode) Progress() Progress {
+	stats, err := n.bitswap.Stat()
+	if err != nil {
+		return Progress{}
+	}
+	return Progress{BytesRcvd: stats.DataReceived, BlocksRcvd: stats.BlocksReceived}
+}
+
+func (n *BitswapNode) SetBlockHook(hook BlockHook) {
+	n.hook.set(hook)
+}
+
 func (n *BitswapNode) Fetch(ctx context.Context, c cid.Cid, _ []PeerInfo) (files.Node, error) {
 	err := merkledag.FetchGraph(ctx, c, n.dserv)
 	if err != nil {
@@ -32,31 +32,52 @@ type syncer interface {
 func NewDAGAdder(ctx context.Context, ds ipld.DAGService, settings AddSettings) (*DAGAdder, error) {
 	bufferedDS := ipld.NewBufferedDAG(ctx, ds)
 
-	prefix, err := dag.PrefixForCidVersion(1)
-	if err != nil {
-		return nil, errors.Wrap(err, "unrecognized CID version")
-	}
-
 	hashFuncCode, ok := multihash.Names[strings.ToLower(settings.HashFunc)]
 	if !ok {
-		return nil, errors.Wrapf(err, "unrecognized hash function %q", settings.HashFunc)
+		return nil, errors.Errorf("unrecognized hash function %q", settings.HashFunc)
+	}
+
+	// CIDv0 only supports sha2-256, upgrade to CIDv1 like go-ipfs does.
+	cidVersion := settings.CidVersion
+	if cidVersion == 0 && hashFuncCode != multihash.SHA2_256 {
+		cidVersion = 1
+	}
+	prefix, err := dag.PrefixForCidVersion(cidVersion)
+	if err != nil {
+		return nil, errors.Wrap(err, "unrecognized CID version")
 	}
 	prefix.MhType = hashFuncCode
+	prefix.MhLength = -1
+
 	return &DAGAdder{
 		ctx:        ctx,
 		dagService: ds,
 		bufferedDS: bufferedDS,
+		CidBuilder: prefix,
 		settings:   settings,
 	}, nil
 }
 
+// AddSettings determine how files are imported into a DAG.
 type AddSettings struct {
-	Layout    string
-	Chunker   string
-	RawLeaves bool
-	NoCopy    bool
-	HashFunc  string
-	MaxLinks  int
+	Layout     string
+	Chunker    string
+	RawLeaves  bool
+	NoCopy     bool
+	HashFunc   string
+	MaxLinks   int
+	CidVersion int
+}
+
+// DefaultAddSettings are the settings used when no DAG import params are set.
+var DefaultAddSettings = AddSettings{
+	Layout:     "balanced",
+	Chunker:    "size-262144",
+	RawLeaves:  false,
+	NoCopy:     false,
+	HashFunc:   "sha2-256",
+	MaxLinks:   ihelper.DefaultLinksPerBlock,
+	CidVersion: 0,
 }
 
 // DAGAdder holds the switches passed to the `add` command.
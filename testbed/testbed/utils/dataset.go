@@ -0,0 +1,240 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Content types supported for custom datasets.
+const (
+	ContentRandom       = "random"
+	ContentZeros        = "zeros"
+	ContentText         = "text"
+	ContentCompressible = "compressible"
+)
+
+// generatedName matches the names given to the generated directories, files
+// and unnamed entries, which custom names can't take.
+var generatedName = regexp.MustCompile(`^(dir|file|entry)-[0-9]+$`)
+
+const loremIpsum = "Lorem ipsum dolor sit amet, consectetur adipiscing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. "
+
+// CustomSpec declares a file or a directory tree to be generated for the
+// custom input_data mode. For example, a 500-file website could be declared as:
+//
+//	{"type": "dir", "count": 500, "size": 20480, "depth": 2, "fanout": 4, "content": "text"}
+type CustomSpec struct {
+	// Name of the file or directory. Generated if empty.
+	Name string `json:"name"`
+	// Type is either "file" or "dir".
+	Type string `json:"type"`
+	// Size in bytes of the file (or of each file in the directory tree).
+	Size int64 `json:"size"`
+	// Count is the number of files spread across the directory tree.
+	Count int `json:"count"`
+	// Depth is the number of nested directory levels below the root.
+	Depth int `json:"depth"`
+	// Fanout is the number of subdirectories per directory.
+	Fanout int `json:"fanout"`
+	// Content is the type of data: random, zeros, text or compressible.
+	Content string `json:"content"`
+	// Entries are additional files or trees added to the root of the directory.
+	Entries []CustomSpec `json:"entries"`
+}
+
+// ParseCustomSpecs parses a JSON list of dataset specs. Each spec is a
+// different test file.
+func ParseCustomSpecs(value string) ([]CustomSpec, error) {
+	var specs []CustomSpec
+	if err := json.Unmarshal([]byte(value), &specs); err != nil {
+		return nil, fmt.Errorf("Could not parse custom data spec: %w", err)
+	}
+	if len(specs) == 0 {
+		return nil, fmt.Errorf("Custom data spec is empty")
+	}
+	for i := range specs {
+		if err := specs[i].validate(); err != nil {
+			return nil, err
+		}
+	}
+	return specs, nil
+}
+
+// validate checks the spec and fills in the defaults.
+func (s *CustomSpec) validate() error {
+	if s.Type == "" {
+		s.Type = "file"
+	}
+	if s.Content == "" {
+		s.Content = ContentRandom
+	}
+	switch s.Content {
+	case ContentRandom, ContentZeros, ContentText, ContentCompressible:
+	default:
+		return fmt.Errorf("Unknown content type %q", s.Content)
+	}
+	if s.Size < 0 || s.Count < 0 || s.Depth < 0 || s.Fanout < 0 {
+		return fmt.Errorf("Invalid custom data spec %+v: negative values not allowed", *s)
+	}
+	if s.Name != "" {
+		if s.Name == "." || s.Name == ".." || strings.ContainsAny(s.Name, "/"+string(filepath.Separator)) {
+			return fmt.Errorf("Invalid custom data name %q: must be a single path element", s.Name)
+		}
+		if generatedName.MatchString(s.Name) {
+			return fmt.Errorf("Invalid custom data name %q: reserved for generated names", s.Name)
+		}
+	}
+
+	switch s.Type {
+	case "file":
+		if len(s.Entries) > 0 {
+			return fmt.Errorf("Custom file %q can't have entries", s.Name)
+		}
+	case "dir":
+		if s.Depth > 0 && s.Fanout == 0 {
+			s.Fanout = 1
+		}
+		names := make(map[string]bool)
+		for i := range s.Entries {
+			if err := s.Entries[i].validate(); err != nil {
+				return err
+			}
+			if name := s.Entries[i].Name; name != "" {
+				if names[name] {
+					return fmt.Errorf("Duplicate custom data name %q in %q", name, s.Name)
+				}
+				names[name] = true
+			}
+		}
+	default:
+		return fmt.Errorf("Unknown custom data type %q", s.Type)
+	}
+	return nil
+}
+
+// size returns the total number of bytes of the file or tree.
+func (s CustomSpec) size() int64 {
+	if s.Type == "file" {
+		return s.Size
+	}
+	total := int64(s.Count) * s.Size
+	for _, e := range s.Entries {
+		total += e.size()
+	}
+	return total
+}
+
+// generate writes the file or tree at path. The seed determines the content
+// of every generated file.
+func (s CustomSpec) generate(path string, seed int64) (int64, error) {
+	seeder := rand.New(rand.NewSource(seed))
+	if s.Type == "file" {
+		return writeContent(path, s.Content, s.Size, seeder.Int63())
+	}
+
+	// Directories of the tree in breadth-first order.
+	dirs := []string{path}
+	level := []string{path}
+	for d := 0; d < s.Depth; d++ {
+		var next []string
+		for _, parent := range level {
+			for f := 0; f < s.Fanout; f++ {
+				next = append(next, filepath.Join(parent, fmt.Sprintf("dir-%d", f)))
+			}
+		}
+		dirs = append(dirs, next...)
+		level = next
+	}
+	for _, d := range dirs {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			return 0, err
+		}
+	}
+
+	var written int64
+	// Files are spread round-robin across all directories of the tree.
+	for i := 0; i < s.Count; i++ {
+		fpath := filepath.Join(dirs[i%len(dirs)], fmt.Sprintf("file-%d", i))
+		n, err := writeContent(fpath, s.Content, s.Size, seeder.Int63())
+		if err != nil {
+			return written, err
+		}
+		written += n
+	}
+
+	for i, e := range s.Entries {
+		name := e.Name
+		if name == "" {
+			name = fmt.Sprintf("entry-%d", i)
+		}
+		n, err := e.generate(filepath.Join(path, name), seeder.Int63())
+		if err != nil {
+			return written, err
+		}
+		written += n
+	}
+	return written, nil
+}
+
+func writeContent(path string, content string, size int64, seed int64) (int64, error) {
+	tf, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(tf, contentReader(content, size, seed))
+	if err != nil {
+		tf.Close()
+		return n, err
+	}
+	return n, tf.Close()
+}
+
+// contentReader returns a reader of size bytes of the given content type.
+func contentReader(content string, size int64, seed int64) io.Reader {
+	var r io.Reader
+	switch content {
+	case ContentZeros:
+		r = &patternReader{pattern: []byte{0}}
+	case ContentText:
+		r = &patternReader{pattern: []byte(loremIpsum)}
+	case ContentCompressible:
+		r = &compressibleReader{rand.New(rand.NewSource(seed))}
+	default:
+		r = rand.New(rand.NewSource(seed))
+	}
+	return io.LimitReader(r, size)
+}
+
+// patternReader repeats the same pattern forever.
+type patternReader struct {
+	pattern []byte
+	offset  int
+}
+
+func (r *patternReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = r.pattern[r.offset]
+		r.offset = (r.offset + 1) % len(r.pattern)
+	}
+	return len(p), nil
+}
+
+// compressibleReader generates random data with half of the entropy
+// of a random stream, so it compresses to roughly 50% of its size.
+type compressibleReader struct {
+	r *rand.Rand
+}
+
+func (r *compressibleReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	for i := 0; i < n; i++ {
+		p[i] = 'a' + p[i]&0x0f
+	}
+	return n, err
+}
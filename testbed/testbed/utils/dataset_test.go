@@ -0,0 +1,30 @@
+package utils
+
+import "testing"
+
+func TestParseCustomSpecs(t *testing.T) {
+	cases := []struct {
+		value   string
+		invalid bool
+	}{
+		{value: `[{"type": "dir", "count": 10, "size": 1024, "depth": 2, "fanout": 2}]`},
+		{value: `[{"type": "dir", "entries": [{"name": "index.html"}, {"name": "assets", "type": "dir"}, {}]}]`},
+		{value: `[{"type": "dir", "entries": [{"name": "../escape"}]}]`, invalid: true},
+		{value: `[{"type": "dir", "entries": [{"name": "a/b"}]}]`, invalid: true},
+		{value: `[{"type": "dir", "entries": [{"name": ".."}]}]`, invalid: true},
+		{value: `[{"type": "dir", "entries": [{"name": "."}]}]`, invalid: true},
+		{value: `[{"type": "dir", "entries": [{"name": "a"}, {"name": "a", "type": "dir"}]}]`, invalid: true},
+		{value: `[{"type": "dir", "depth": 1, "entries": [{"name": "dir-0"}]}]`, invalid: true},
+		{value: `[{"type": "dir", "count": 1, "entries": [{"name": "file-0"}]}]`, invalid: true},
+		{value: `[{"type": "dir", "entries": [{}, {"name": "entry-0"}]}]`, invalid: true},
+		{value: `[{"type": "file", "content": "unknown"}]`, invalid: true},
+	}
+	for _, tt := range cases {
+		_, err := ParseCustomSpecs(tt.value)
+		if tt.invalid && err == nil {
+			t.Errorf("ParseCustomSpecs(%s): expected an error", tt.value)
+		} else if !tt.invalid && err != nil {
+			t.Errorf("ParseCustomSpecs(%s): %v", tt.value, err)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package dialer
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/libp2p/go-libp2p"
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/protocol/beyond-bitswap/testbed/testbed/utils"
+	"golang.org/x/sync/errgroup"
+)
+
+// Node types of the peers of the dialer tests, by sequence number.
+var testNodeTypes = []utils.NodeType{utils.Seed, utils.Seed, utils.Leech, utils.Leech, utils.Passive, utils.Passive}
+
+// edge is an edge between the indices of two peers, the lowest first.
+type edge [2]int
+
+func newEdge(i, j int) edge {
+	if i > j {
+		i, j = j, i
+	}
+	return edge{i, j}
+}
+
+func TestDialers(t *testing.T) {
+	n := len(testNodeTypes)
+	allEdges := func(ais []utils.PeerInfo) map[edge]bool {
+		edges := make(map[edge]bool)
+		for i := 0; i < n; i++ {
+			for j := i + 1; j < n; j++ {
+				edges[edge{i, j}] = true
+			}
+		}
+		return edges
+	}
+	graphEdges := func(g *graph) map[edge]bool {
+		edges := make(map[edge]bool)
+		for i := range g.adj {
+			for _, j := range g.neighbours(i) {
+				edges[newEdge(i, j)] = true
+			}
+		}
+		return edges
+	}
+
+	topologyFile := writeTopologyFile(t, "seed:0 passive:0\nseed:1 passive:0\npassive:0 leech:0\n# comment\npassive:0 leech:1\n")
+	cases := []struct {
+		name   string
+		params TopologyParams
+		// expected returns the edges between the peers.
+		expected func(ais []utils.PeerInfo) map[edge]bool
+	}{
+		{"default", TopologyParams{}, allEdges},
+		{"sparse", TopologyParams{}, func(ais []utils.PeerInfo) map[edge]bool {
+			edges := allEdges(ais)
+			for e := range edges {
+				a, b := ais[e[0]].Nodetp, ais[e[1]].Nodetp
+				if (a == utils.Seed && b == utils.Leech) || (a == utils.Leech && b == utils.Seed) {
+					delete(edges, e)
+				}
+			}
+			return edges
+		}},
+		{"ring", TopologyParams{}, func(ais []utils.PeerInfo) map[edge]bool {
+			return graphEdges(ring(n))
+		}},
+		{"star", TopologyParams{Hub: "leech:1"}, func(ais []utils.PeerInfo) map[edge]bool {
+			return graphEdges(star(n, 3))
+		}},
+		{"file", TopologyParams{File: topologyFile, Format: FormatEdges}, func(ais []utils.PeerInfo) map[edge]bool {
+			return map[edge]bool{{0, 4}: true, {1, 4}: true, {2, 4}: true, {3, 4}: true}
+		}},
+	}
+	for _, tt := range cases {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			d, err := New(tt.name, tt.params)
+			if err != nil {
+				t.Fatal(err)
+			}
+			hosts, ais := newTestPeers(ctx, t)
+			got := dialAll(ctx, t, d, hosts, ais, 100)
+			expected := tt.expected(ais)
+			for e := range expected {
+				if !got[e] {
+					t.Errorf("peers %d and %d are not connected", e[0], e[1])
+				}
+			}
+			for e := range got {
+				if !expected[e] {
+					t.Errorf("peers %d and %d are connected", e[0], e[1])
+				}
+			}
+		})
+	}
+}
+
+// The max connection rate limits the peers dialed by every peer, which only
+// dials peers with lower IDs.
+func TestDialMaxConnectionRate(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	hosts, ais := newTestPeers(ctx, t)
+	got := dialAll(ctx, t, DialOtherPeers, hosts, ais, 50)
+	// Peers sorted by ID dial 0, 1, 1, 2, 2 and 3 peers.
+	if len(got) != 9 {
+		t.Errorf("%d connections with a max connection rate of 50%%, expected 9", len(got))
+	}
+}
+
+func TestNewUnknownDialer(t *testing.T) {
+	if _, err := New("mesh", TopologyParams{}); err == nil {
+		t.Error("expected an error for an unknown dialer")
+	}
+	if _, err := New("file", TopologyParams{}); err == nil {
+		t.Error("expected an error for a file dialer without file")
+	}
+}
+
+// dialAll runs the dialer on every host and returns the edges dialed. Dialed
+// peers must be connected.
+func dialAll(ctx context.Context, t *testing.T, d Dialer, hosts []core.Host, ais []utils.PeerInfo, maxConnectionRate int) map[edge]bool {
+	t.Helper()
+	indices := make(map[string]int)
+	for i, inf := range ais {
+		indices[inf.Addr.ID.String()] = i
+	}
+	dialed := make([][]int, len(hosts))
+	g, gctx := errgroup.WithContext(ctx)
+	for i, h := range hosts {
+		i, h := i, h
+		g.Go(func() error {
+			toDial, err := d(gctx, h, ais[i].Nodetp, ais, maxConnectionRate)
+			for _, ai := range toDial {
+				if h.Network().Connectedness(ai.ID) != network.Connected {
+					t.Errorf("peer %d is not connected to dialed peer %s", i, ai.ID)
+				}
+				dialed[i] = append(dialed[i], indices[ai.ID.String()])
+			}
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		t.Fatal(err)
+	}
+
+	edges := make(map[edge]bool)
+	for i, js := range dialed {
+		for _, j := range js {
+			e := newEdge(i, j)
+			if edges[e] {
+				t.Errorf("peers %d and %d dialed each other", i, j)
+			}
+			edges[e] = true
+		}
+	}
+	return edges
+}
+
+// newTestPeers creates a host listening on loopback for every node type and
+// returns the hosts with their peer infos.
+func newTestPeers(ctx context.Context, t *testing.T) ([]core.Host, []utils.PeerInfo) {
+	t.Helper()
+	var hosts []core.Host
+	var ais []utils.PeerInfo
+	tpindices := make(map[utils.NodeType]int)
+	for i, tp := range testNodeTypes {
+		h, err := libp2p.New(ctx, libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { h.Close() })
+		hosts = append(hosts, h)
+
+		inf := utils.PeerInfo{Nodetp: tp, Seq: int64(i + 1), Tpindex: tpindices[tp]}
+		inf.Addr.ID, inf.Addr.Addrs = h.ID(), h.Addrs()
+		ais = append(ais, inf)
+		tpindices[tp]++
+	}
+	return hosts, ais
+}
+
+func writeTopologyFile(t *testing.T, content string) string {
+	t.Helper()
+	f, err := ioutil.TempFile("", "topology")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Remove(f.Name()) })
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
@@ -0,0 +1,113 @@
+package dialer
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/protocol/beyond-bitswap/testbed/testbed/utils"
+)
+
+// Formats of topology files.
+const (
+	// FormatEdges is a list of edges, one per line, with the two ends
+	// separated by spaces or commas. Nodes are referred to as in nodeIndex.
+	FormatEdges = "edges"
+	// FormatMatrix is an adjacency matrix, one row per line, with 0 or 1
+	// values separated by spaces or commas. Row i is the node with
+	// sequence number i+1.
+	FormatMatrix = "matrix"
+)
+
+// fileTopology returns the topology read from the file. Empty lines and
+// lines starting with # are ignored.
+func fileTopology(path string, format string) (topology, error) {
+	if path == "" {
+		return nil, fmt.Errorf("No topology file set")
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read topology file: %w", err)
+	}
+	defer f.Close()
+
+	var rows [][]string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rows = append(rows, strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		}))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatEdges:
+		return func(ais []utils.PeerInfo) (*graph, error) {
+			return edgesGraph(ais, rows)
+		}, nil
+	case FormatMatrix:
+		return func(ais []utils.PeerInfo) (*graph, error) {
+			return matrixGraph(ais, rows)
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unknown topology format %q", format)
+	}
+}
+
+func edgesGraph(ais []utils.PeerInfo, rows [][]string) (*graph, error) {
+	g := newGraph(len(ais))
+	for _, row := range rows {
+		if len(row) != 2 {
+			return nil, fmt.Errorf("Invalid edge %v, expected two nodes", row)
+		}
+		i, err := nodeIndex(ais, row[0])
+		if err != nil {
+			return nil, err
+		}
+		j, err := nodeIndex(ais, row[1])
+		if err != nil {
+			return nil, err
+		}
+		g.addEdge(i, j)
+	}
+	return g, nil
+}
+
+func matrixGraph(ais []utils.PeerInfo, rows [][]string) (*graph, error) {
+	if len(rows) != len(ais) {
+		return nil, fmt.Errorf("Adjacency matrix has %d rows for %d nodes", len(rows), len(ais))
+	}
+	// Indices in the list of peers by sequence number.
+	indices := make([]int, len(ais))
+	for s := range indices {
+		i, err := nodeIndex(ais, fmt.Sprint(s+1))
+		if err != nil {
+			return nil, err
+		}
+		indices[s] = i
+	}
+
+	g := newGraph(len(ais))
+	for s, row := range rows {
+		if len(row) != len(ais) {
+			return nil, fmt.Errorf("Row %d of the adjacency matrix has %d columns for %d nodes", s, len(row), len(ais))
+		}
+		for t, v := range row {
+			switch v {
+			case "0":
+			case "1":
+				g.addEdge(indices[s], indices[t])
+			default:
+				return nil, fmt.Errorf("Invalid value %q in the adjacency matrix", v)
+			}
+		}
+	}
+	return g, nil
+}
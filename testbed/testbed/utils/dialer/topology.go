@@ -0,0 +1,301 @@
+package dialer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	core "github.com/libp2p/go-libp2p-core"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/protocol/beyond-bitswap/testbed/testbed/utils"
+	"golang.org/x/sync/errgroup"
+)
+
+// Edge swaps per edge to randomize regular graphs.
+const regularSwapsPerEdge = 10
+
+// TopologyParams configures the topology dialers.
+type TopologyParams struct {
+	// Seed of the random topologies. Every instance computes the same graph.
+	Seed int64
+	// Hub is the center of the star, as "<node type>:<index>" (e.g. "seed:0").
+	// See nodeIndex for all the ways to refer to a node.
+	Hub string
+	// Degree is the number of neighbours of each node in random regular
+	// and small-world topologies.
+	Degree int
+	// RewirePct is the probability of rewiring each edge in small-world topologies.
+	RewirePct int
+	// File and Format of the topology file (edges or matrix).
+	File   string
+	Format string
+}
+
+// New returns the dialer with the given name.
+func New(name string, params TopologyParams) (Dialer, error) {
+	switch name {
+	case "", "default":
+		return DialOtherPeers, nil
+	case "sparse":
+		return SparseDial, nil
+	case "ring":
+		return topologyDialer(func(ais []utils.PeerInfo) (*graph, error) {
+			return ring(len(ais)), nil
+		}), nil
+	case "star":
+		return topologyDialer(func(ais []utils.PeerInfo) (*graph, error) {
+			hub, err := nodeIndex(ais, params.Hub)
+			if err != nil {
+				return nil, err
+			}
+			return star(len(ais), hub), nil
+		}), nil
+	case "regular":
+		return topologyDialer(func(ais []utils.PeerInfo) (*graph, error) {
+			return randomRegular(len(ais), params.Degree, rand.New(rand.NewSource(params.Seed)))
+		}), nil
+	case "small-world":
+		return topologyDialer(func(ais []utils.PeerInfo) (*graph, error) {
+			return wattsStrogatz(len(ais), params.Degree, float64(params.RewirePct)/100, rand.New(rand.NewSource(params.Seed)))
+		}), nil
+	case "file":
+		build, err := fileTopology(params.File, params.Format)
+		if err != nil {
+			return nil, err
+		}
+		return topologyDialer(build), nil
+	default:
+		return nil, fmt.Errorf("Unknown dialer %q", name)
+	}
+}
+
+// topology builds a graph among the peers. Nodes are the indices of the peers
+// in the list of peer infos, which is the same for every instance.
+type topology func(ais []utils.PeerInfo) (*graph, error)
+
+// topologyDialer returns a dialer that connects the peers following the edges
+// of the topology. The max connection rate doesn't apply to topologies.
+func topologyDialer(build topology) Dialer {
+	return func(ctx context.Context, self core.Host, selfType utils.NodeType, ais []utils.PeerInfo, maxConnectionRate int) ([]peer.AddrInfo, error) {
+		g, err := build(ais)
+		if err != nil {
+			return nil, err
+		}
+		selfIndex := -1
+		for i, inf := range ais {
+			if inf.Addr.ID == self.ID() {
+				selfIndex = i
+				break
+			}
+		}
+		if selfIndex < 0 {
+			return nil, fmt.Errorf("peer %s not found in the list of peers", self.ID())
+		}
+
+		var toDial []peer.AddrInfo
+		id2, _ := self.ID().MarshalBinary()
+		for _, j := range g.neighbours(selfIndex) {
+			ai := ais[j].Addr
+			id1, _ := ai.ID.MarshalBinary()
+			// Only one end of each edge dials, to prevent TCP simultaneous
+			// connect (known to fail).
+			if bytes.Compare(id1, id2) < 0 {
+				toDial = append(toDial, ai)
+			}
+		}
+		return toDial, connectAll(ctx, self, toDial)
+	}
+}
+
+func connectAll(ctx context.Context, self core.Host, toDial []peer.AddrInfo) error {
+	g, ctx := errgroup.WithContext(ctx)
+	for _, ai := range toDial {
+		ai := ai
+		g.Go(func() error {
+			if err := self.Connect(ctx, ai); err != nil {
+				return fmt.Errorf("Error while dialing peer %v: %w", ai.Addrs, err)
+			}
+			return nil
+		})
+	}
+	return g.Wait()
+}
+
+// graph is an undirected graph without self-loops nor parallel edges.
+type graph struct {
+	adj []map[int]bool
+}
+
+func newGraph(n int) *graph {
+	g := &graph{adj: make([]map[int]bool, n)}
+	for i := range g.adj {
+		g.adj[i] = make(map[int]bool)
+	}
+	return g
+}
+
+// addEdge adds the edge between i and j. It returns false if the edge
+// is a self-loop or already exists.
+func (g *graph) addEdge(i, j int) bool {
+	if i == j || g.adj[i][j] {
+		return false
+	}
+	g.adj[i][j] = true
+	g.adj[j][i] = true
+	return true
+}
+
+func (g *graph) removeEdge(i, j int) {
+	delete(g.adj[i], j)
+	delete(g.adj[j], i)
+}
+
+// neighbours returns the neighbours of i in ascending order.
+func (g *graph) neighbours(i int) []int {
+	var ns []int
+	for j := range g.adj {
+		if g.adj[i][j] {
+			ns = append(ns, j)
+		}
+	}
+	return ns
+}
+
+// nodeIndex returns the index in the list of peers of the node given as its
+// sequence number ("7"), its type and index among the nodes of its type
+// ("seed:0"), or also its group ("group:seed:0").
+func nodeIndex(ais []utils.PeerInfo, node string) (int, error) {
+	parts := strings.Split(node, ":")
+	var match func(inf utils.PeerInfo) bool
+	switch len(parts) {
+	case 1:
+		seq, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("Invalid node %q: %w", node, err)
+		}
+		match = func(inf utils.PeerInfo) bool { return inf.Seq == seq }
+	case 2, 3:
+		group := ""
+		if len(parts) == 3 {
+			group, parts = parts[0], parts[1:]
+		}
+		tpindex, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return 0, fmt.Errorf("Invalid node %q: %w", node, err)
+		}
+		match = func(inf utils.PeerInfo) bool {
+			return strings.EqualFold(inf.Nodetp.String(), parts[0]) && inf.Tpindex == tpindex &&
+				(group == "" || inf.Group == group)
+		}
+	default:
+		return 0, fmt.Errorf("Invalid node %q, expected <seq>, <node type>:<index> or <group>:<node type>:<index>", node)
+	}
+
+	index := -1
+	for i, inf := range ais {
+		if !match(inf) {
+			continue
+		}
+		if index >= 0 {
+			return 0, fmt.Errorf("Node %q is ambiguous, set its group", node)
+		}
+		index = i
+	}
+	if index < 0 {
+		return 0, fmt.Errorf("Node %q not found", node)
+	}
+	return index, nil
+}
+
+// ring connects every node with the next one.
+func ring(n int) *graph {
+	g := newGraph(n)
+	for i := 0; i < n && n > 1; i++ {
+		g.addEdge(i, (i+1)%n)
+	}
+	return g
+}
+
+// star connects every node with the hub.
+func star(n int, hub int) *graph {
+	g := newGraph(n)
+	for i := 0; i < n; i++ {
+		g.addEdge(hub, i)
+	}
+	return g
+}
+
+// randomRegular builds a random graph where every node has k neighbours. It
+// starts from a circulant graph, connecting every node with its k/2 nearest
+// neighbours on each side (and the opposite node if k is odd), and
+// randomizes it with degree-preserving swaps: two random edges (a, b) and
+// (c, d) are replaced with (a, d) and (c, b), unless that would add a
+// self-loop or a parallel edge.
+func randomRegular(n int, k int, r *rand.Rand) (*graph, error) {
+	if k < 0 || k >= n || (n*k)%2 != 0 {
+		return nil, fmt.Errorf("No %d-regular graph with %d nodes", k, n)
+	}
+	g := newGraph(n)
+	var edges [][2]int
+	for i := 0; i < n; i++ {
+		for d := 1; d <= k/2; d++ {
+			g.addEdge(i, (i+d)%n)
+			edges = append(edges, [2]int{i, (i + d) % n})
+		}
+		if k%2 == 1 && i < n/2 {
+			g.addEdge(i, i+n/2)
+			edges = append(edges, [2]int{i, i + n/2})
+		}
+	}
+
+	for s := 0; s < regularSwapsPerEdge*len(edges) && len(edges) > 1; s++ {
+		x, y := r.Intn(len(edges)), r.Intn(len(edges))
+		a, b := edges[x][0], edges[x][1]
+		c, d := edges[y][0], edges[y][1]
+		if r.Intn(2) == 0 {
+			c, d = d, c
+		}
+		if x == y || a == d || c == b || g.adj[a][d] || g.adj[c][b] {
+			continue
+		}
+		g.removeEdge(a, b)
+		g.removeEdge(c, d)
+		g.addEdge(a, d)
+		g.addEdge(c, b)
+		edges[x], edges[y] = [2]int{a, d}, [2]int{c, b}
+	}
+	return g, nil
+}
+
+// wattsStrogatz builds a small-world graph: a ring lattice where each node is
+// connected to its k nearest neighbours, with every edge rewired to a random
+// node with probability beta.
+func wattsStrogatz(n int, k int, beta float64, r *rand.Rand) (*graph, error) {
+	if k < 2 || k%2 != 0 || k >= n {
+		return nil, fmt.Errorf("Small-world degree must be even and between 2 and %d, got %d", n-1, k)
+	}
+	g := newGraph(n)
+	for i := 0; i < n; i++ {
+		for j := 1; j <= k/2; j++ {
+			g.addEdge(i, (i+j)%n)
+		}
+	}
+	for j := 1; j <= k/2; j++ {
+		for i := 0; i < n; i++ {
+			// Nodes already connected to every other node can't be rewired.
+			if r.Float64() >= beta || len(g.adj[i]) == n-1 || !g.adj[i][(i+j)%n] {
+				continue
+			}
+			target := r.Intn(n)
+			for target == i || g.adj[i][target] {
+				target = r.Intn(n)
+			}
+			g.removeEdge(i, (i+j)%n)
+			g.addEdge(i, target)
+		}
+	}
+	return g, nil
+}
@@ -0,0 +1,181 @@
+package dialer
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/protocol/beyond-bitswap/testbed/testbed/utils"
+)
+
+func TestNodeIndex(t *testing.T) {
+	ais := []utils.PeerInfo{
+		{Nodetp: utils.Seed, Seq: 3, Group: "a", Tpindex: 0},
+		{Nodetp: utils.Leech, Seq: 1, Group: "a", Tpindex: 0},
+		{Nodetp: utils.Seed, Seq: 2, Group: "b", Tpindex: 0},
+		{Nodetp: utils.Passive, Seq: 4, Group: "b", Tpindex: 1},
+	}
+	cases := []struct {
+		node    string
+		index   int
+		invalid bool
+	}{
+		{node: "1", index: 1},
+		{node: "3", index: 0},
+		{node: "leech:0", index: 1},
+		{node: "Passive:1", index: 3},
+		{node: "b:seed:0", index: 2},
+		{node: "a:seed:0", index: 0},
+		// Both groups have seed 0.
+		{node: "seed:0", invalid: true},
+		{node: "5", invalid: true},
+		{node: "leech:x", invalid: true},
+		{node: "a:b:c:d", invalid: true},
+	}
+	for _, tt := range cases {
+		index, err := nodeIndex(ais, tt.node)
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("nodeIndex(%q) = %d, expected an error", tt.node, index)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("nodeIndex(%q): %v", tt.node, err)
+		} else if index != tt.index {
+			t.Errorf("nodeIndex(%q) = %d, expected %d", tt.node, index, tt.index)
+		}
+	}
+}
+
+func TestRandomRegular(t *testing.T) {
+	cases := []struct {
+		n, k    int
+		invalid bool
+	}{
+		{n: 10, k: 4},
+		{n: 8, k: 3},
+		{n: 12, k: 6},
+		{n: 16, k: 8},
+		{n: 9, k: 8},
+		{n: 5, k: 0},
+		{n: 5, k: 3, invalid: true},
+		{n: 4, k: 4, invalid: true},
+	}
+	for _, tt := range cases {
+		graphs := make(map[string]bool)
+		for seed := int64(0); seed < 50; seed++ {
+			g, err := randomRegular(tt.n, tt.k, rand.New(rand.NewSource(seed)))
+			if tt.invalid {
+				if err == nil {
+					t.Errorf("randomRegular(%d, %d): expected an error", tt.n, tt.k)
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("randomRegular(%d, %d) with seed %d: %v", tt.n, tt.k, seed, err)
+			}
+			for i := range g.adj {
+				if d := len(g.neighbours(i)); d != tt.k || g.adj[i][i] {
+					t.Errorf("randomRegular(%d, %d) with seed %d: node %d has %d neighbours", tt.n, tt.k, seed, i, d)
+				}
+			}
+			// Every instance must compute the same graph.
+			again, _ := randomRegular(tt.n, tt.k, rand.New(rand.NewSource(seed)))
+			if !reflect.DeepEqual(g, again) {
+				t.Errorf("randomRegular(%d, %d) with seed %d is not deterministic", tt.n, tt.k, seed)
+			}
+			graphs[fmt.Sprint(g.adj)] = true
+		}
+		// Graphs other than the complete and empty ones depend on the seed.
+		if !tt.invalid && tt.k > 0 && tt.k < tt.n-1 && len(graphs) < 2 {
+			t.Errorf("randomRegular(%d, %d) builds the same graph with every seed", tt.n, tt.k)
+		}
+	}
+}
+
+func TestWattsStrogatz(t *testing.T) {
+	cases := []struct {
+		n, k    int
+		beta    float64
+		invalid bool
+	}{
+		{n: 10, k: 4, beta: 0},
+		{n: 10, k: 4, beta: 0.5},
+		{n: 5, k: 4, beta: 1},
+		{n: 10, k: 3, invalid: true},
+		{n: 4, k: 4, invalid: true},
+	}
+	for _, tt := range cases {
+		g, err := wattsStrogatz(tt.n, tt.k, tt.beta, rand.New(rand.NewSource(1)))
+		if tt.invalid {
+			if err == nil {
+				t.Errorf("wattsStrogatz(%d, %d): expected an error", tt.n, tt.k)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("wattsStrogatz(%d, %d): %v", tt.n, tt.k, err)
+		}
+		// Rewiring keeps the number of edges.
+		degrees := 0
+		for i := range g.adj {
+			degrees += len(g.neighbours(i))
+		}
+		if degrees != tt.n*tt.k {
+			t.Errorf("wattsStrogatz(%d, %d, %g) has %d edges, expected %d", tt.n, tt.k, tt.beta, degrees/2, tt.n*tt.k/2)
+		}
+		if tt.beta == 0 && !reflect.DeepEqual(g.neighbours(0), []int{1, 2, 8, 9}) {
+			t.Errorf("wattsStrogatz(%d, %d, 0) is not a ring lattice: %v", tt.n, tt.k, g.neighbours(0))
+		}
+	}
+}
+
+func TestMatrixGraph(t *testing.T) {
+	// Peers are not sorted by sequence number.
+	ais := []utils.PeerInfo{{Seq: 2}, {Seq: 3}, {Seq: 1}}
+	rows := [][]string{
+		{"0", "1", "0"},
+		{"1", "0", "1"},
+		{"0", "1", "0"},
+	}
+	g, err := matrixGraph(ais, rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Sequence number 2 is connected to 1 and 3.
+	if ns := g.neighbours(0); !reflect.DeepEqual(ns, []int{1, 2}) {
+		t.Errorf("neighbours of seq 2 are %v, expected [1 2]", ns)
+	}
+	if ns := g.neighbours(1); !reflect.DeepEqual(ns, []int{0}) {
+		t.Errorf("neighbours of seq 3 are %v, expected [0]", ns)
+	}
+
+	if _, err := matrixGraph(ais, rows[:2]); err == nil {
+		t.Error("expected an error for a missing row")
+	}
+	if _, err := matrixGraph(ais, [][]string{{"0", "2", "0"}, rows[1], rows[2]}); err == nil {
+		t.Error("expected an error for an invalid value")
+	}
+}
+
+// TestRandomRegularSeeds builds random regular graphs of the sizes and
+// degrees used in experiments with many seeds, as every seed must work.
+func TestRandomRegularSeeds(t *testing.T) {
+	for _, n := range []int{10, 20, 64} {
+		for _, k := range []int{4, 6, 8} {
+			for seed := int64(0); seed < 200; seed++ {
+				g, err := randomRegular(n, k, rand.New(rand.NewSource(seed)))
+				if err != nil {
+					t.Fatalf("randomRegular(%d, %d) with seed %d: %v", n, k, seed, err)
+				}
+				for i := range g.adj {
+					if d := len(g.neighbours(i)); d != k || g.adj[i][i] {
+						t.Fatalf("randomRegular(%d, %d) with seed %d: node %d has %d neighbours", n, k, seed, i, d)
+					}
+				}
+			}
+		}
+	}
+}
@@ -3,17 +3,37 @@ package utils
 import (
 	"context"
 	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
 
 	"github.com/ipfs/go-bitswap"
 	"github.com/ipfs/go-bitswap/network"
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	"github.com/ipfs/go-graphsync"
+	gsimpl "github.com/ipfs/go-graphsync/impl"
+	gsnet "github.com/ipfs/go-graphsync/network"
+	"github.com/ipfs/go-graphsync/storeutil"
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	exchange "github.com/ipfs/go-ipfs-exchange-interface"
 	"github.com/ipfs/go-ipfs/core/node/helpers"
+	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/routing"
 	"go.uber.org/fx"
 )
 
+const (
+	// Maximum number of peers a block is requested from with graphsync,
+	// providers first, before giving up or falling back to bitswap.
+	maxGraphsyncPeers = 3
+	// Time to wait for the providers of a block or the first response of a
+	// peer before moving on to the next peer or the fallback.
+	graphsyncStallTimeout = 2 * time.Second
+)
+
 // ExchangeOpt injects exchange interface
 type ExchangeOpt func(helpers.MetricsCtx, fx.Lifecycle, host.Host,
 	routing.Routing, blockstore.GCBlockstore) exchange.Interface
@@ -23,22 +43,216 @@ func SetExchange(ctx context.Context, name string) (ExchangeOpt, error) {
 	switch name {
 	case "bitswap":
 		// Initializing bitswap exchange
+		return newBitswapExchange, nil
+	case "graphsync":
 		return func(mctx helpers.MetricsCtx, lc fx.Lifecycle,
 			host host.Host, rt routing.Routing, bs blockstore.GCBlockstore) exchange.Interface {
-			bitswapNetwork := network.NewFromIpfsHost(host, rt)
-			exch := bitswap.New(helpers.LifecycleCtx(mctx, lc), bitswapNetwork, bs)
-
-			lc.Append(fx.Hook{
-				OnStop: func(ctx context.Context) error {
-					return exch.Close()
-				},
-			})
-			return exch
+			return newGraphsyncExchange(mctx, lc, host, rt, bs, nil)
+		}, nil
+	case "hybrid":
+		// Graphsync first, falling back to bitswap for blocks graphsync couldn't fetch.
+		return func(mctx helpers.MetricsCtx, lc fx.Lifecycle,
+			host host.Host, rt routing.Routing, bs blockstore.GCBlockstore) exchange.Interface {
+			fallback := newBitswapExchange(mctx, lc, host, rt, bs)
+			return newGraphsyncExchange(mctx, lc, host, rt, bs, fallback)
 		}, nil
-
-	// TODO: Add aditional exchanges here
 	default:
 		return nil, errors.New("This exchange interface is not implemented")
 	}
 
 }
+
+func newBitswapExchange(mctx helpers.MetricsCtx, lc fx.Lifecycle,
+	host host.Host, rt routing.Routing, bs blockstore.GCBlockstore) exchange.Interface {
+	bitswapNetwork := network.NewFromIpfsHost(host, rt)
+	exch := bitswap.New(helpers.LifecycleCtx(mctx, lc), bitswapNetwork, bs)
+
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return exch.Close()
+		},
+	})
+	return exch
+}
+
+// GraphsyncExchange is an exchange interface backed by graphsync.
+// When a block is requested, the whole DAG below it is requested from
+// providers and connected peers, so by the time the block is returned its
+// children are already in the blockstore and are not requested again.
+type GraphsyncExchange struct {
+	gs       graphsync.GraphExchange
+	h        host.Host
+	rt       routing.Routing
+	bstore   blockstore.Blockstore
+	fallback exchange.Interface
+
+	totalSent     uint64
+	totalReceived uint64
+	blocksRcvd    uint64
+}
+
+func newGraphsyncExchange(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host,
+	rt routing.Routing, bs blockstore.GCBlockstore, fallback exchange.Interface) *GraphsyncExchange {
+	gs := gsimpl.New(helpers.LifecycleCtx(mctx, lc), gsnet.NewFromLibp2pHost(h),
+		storeutil.LoaderForBlockstore(bs),
+		storeutil.StorerForBlockstore(bs),
+	)
+	e := &GraphsyncExchange{gs: gs, h: h, rt: rt, bstore: bs, fallback: fallback}
+	gs.RegisterBlockSentListener(func(p peer.ID, request graphsync.RequestData, block graphsync.BlockData) {
+		atomic.AddUint64(&e.totalSent, block.BlockSizeOnWire())
+	})
+	gs.RegisterIncomingBlockHook(func(p peer.ID, response graphsync.ResponseData, block graphsync.BlockData, ha graphsync.IncomingBlockHookActions) {
+		atomic.AddUint64(&e.totalReceived, block.BlockSizeOnWire())
+		atomic.AddUint64(&e.blocksRcvd, 1)
+	})
+	gs.RegisterIncomingRequestHook(func(p peer.ID, request graphsync.RequestData, ha graphsync.IncomingRequestHookActions) {
+		ha.ValidateRequest()
+	})
+	return e
+}
+
+// GetBlock fetches the DAG below c with graphsync and returns the block.
+func (e *GraphsyncExchange) GetBlock(ctx context.Context, c cid.Cid) (blocks.Block, error) {
+	if b, err := e.bstore.Get(c); err == nil {
+		return b, nil
+	}
+
+	var lastErr error = fmt.Errorf("no peers to request %s from", c)
+	for _, p := range e.candidates(ctx, c) {
+		if lastErr = e.request(ctx, p, c); lastErr != nil {
+			log.Debugf("graphsync request for %s to %s failed: %v", c, p, lastErr)
+			continue
+		}
+		b, err := e.bstore.Get(c)
+		if err == nil {
+			return b, nil
+		}
+		lastErr = err
+	}
+
+	if e.fallback != nil {
+		return e.fallback.GetBlock(ctx, c)
+	}
+	return nil, lastErr
+}
+
+// GetBlocks fetches the blocks one after the other, as fetching a block
+// already fetches any block below it, and returns them once all of them are
+// fetched, so that a block that can't be fetched fails the whole request.
+func (e *GraphsyncExchange) GetBlocks(ctx context.Context, ks []cid.Cid) (<-chan blocks.Block, error) {
+	out := make(chan blocks.Block, len(ks))
+	defer close(out)
+	for _, c := range ks {
+		b, err := e.GetBlock(ctx, c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get block %s: %w", c, err)
+		}
+		out <- b
+	}
+	return out, nil
+}
+
+// HasBlock announces the block through the fallback exchange. Graphsync
+// serves blocks straight from the blockstore.
+func (e *GraphsyncExchange) HasBlock(b blocks.Block) error {
+	if e.fallback != nil {
+		return e.fallback.HasBlock(b)
+	}
+	return nil
+}
+
+func (e *GraphsyncExchange) IsOnline() bool {
+	return true
+}
+
+func (e *GraphsyncExchange) Close() error {
+	if e.fallback != nil {
+		return e.fallback.Close()
+	}
+	return nil
+}
+
+// Bitswap returns the bitswap fallback exchange, if any.
+func (e *GraphsyncExchange) Bitswap() *bitswap.Bitswap {
+	bs, _ := e.fallback.(*bitswap.Bitswap)
+	return bs
+}
+
+// Stats returns the bytes sent and received through graphsync.
+func (e *GraphsyncExchange) Stats() (sent uint64, received uint64) {
+	return atomic.LoadUint64(&e.totalSent), atomic.LoadUint64(&e.totalReceived)
+}
+
+// BlocksReceived returns the number of blocks received through graphsync.
+func (e *GraphsyncExchange) BlocksReceived() uint64 {
+	return atomic.LoadUint64(&e.blocksRcvd)
+}
+
+// ResetStatCounters resets the graphsync data counters.
+func (e *GraphsyncExchange) ResetStatCounters() {
+	atomic.StoreUint64(&e.totalSent, 0)
+	atomic.StoreUint64(&e.totalReceived, 0)
+	atomic.StoreUint64(&e.blocksRcvd, 0)
+}
+
+// candidates returns up to maxGraphsyncPeers peers to request c from: the
+// providers found in the routing system within graphsyncStallTimeout followed
+// by the rest of connected peers.
+func (e *GraphsyncExchange) candidates(ctx context.Context, c cid.Cid) []peer.ID {
+	var peers []peer.ID
+	seen := make(map[peer.ID]bool)
+	fctx, cancel := context.WithTimeout(ctx, graphsyncStallTimeout)
+	defer cancel()
+	for ai := range e.rt.FindProvidersAsync(fctx, c, maxGraphsyncPeers) {
+		if ai.ID == e.h.ID() || seen[ai.ID] {
+			continue
+		}
+		if err := e.h.Connect(ctx, ai); err != nil {
+			continue
+		}
+		seen[ai.ID] = true
+		peers = append(peers, ai.ID)
+	}
+	for _, p := range e.h.Network().Peers() {
+		if len(peers) >= maxGraphsyncPeers {
+			break
+		}
+		if !seen[p] {
+			seen[p] = true
+			peers = append(peers, p)
+		}
+	}
+	return peers
+}
+
+// request fetches the DAG below c from p. The request is cancelled if p
+// doesn't respond within graphsyncStallTimeout.
+func (e *GraphsyncExchange) request(ctx context.Context, p peer.ID, c cid.Cid) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stalled := time.AfterFunc(graphsyncStallTimeout, cancel)
+	resps, errs := e.gs.Request(ctx, p, cidlink.Link{Cid: c}, selectAll)
+	responded := false
+	for range resps {
+		if !responded {
+			responded = true
+			stalled.Stop()
+		}
+	}
+	if !responded && !stalled.Stop() {
+		// Drain the errors of the cancelled request.
+		for range errs {
+		}
+		return fmt.Errorf("no response from %s in %s", p, graphsyncStallTimeout)
+	}
+
+	var lastError error
+	for err := range errs {
+		if err != nil {
+			lastError = err
+		}
+	}
+	return lastError
+}
+
+var _ exchange.Interface = &GraphsyncExchange{}
@@ -38,6 +38,12 @@ type PathFile struct {
 	isDir bool
 }
 
+// CustomFile is a file or directory tree generated from a CustomSpec.
+type CustomFile struct {
+	spec CustomSpec
+	seed int64
+}
+
 // GenerateFile generates new randomly generated file
 func (f *RandFile) GenerateFile() (files.Node, error) {
 	r := SeededRandReader(int(f.size), f.seed)
@@ -77,6 +83,38 @@ func (f *PathFile) GenerateFile() (files.Node, error) {
 	return tmpFile, nil
 }
 
+// GenerateFile generates the file or directory tree described by the spec.
+// Content is derived from the file seed so that every seed generates the same data.
+func (f *CustomFile) GenerateFile() (files.Node, error) {
+	path := fmt.Sprintf("/tmp-%d", rand.Uint64())
+	if _, err := f.spec.generate(path, f.seed); err != nil {
+		return nil, err
+	}
+	return getUnixfsNode(path)
+}
+
+// Size returns size
+func (f *CustomFile) Size() int64 {
+	return f.spec.size()
+}
+
+// CatalogFiles returns n files like f, generated with different seeds. The
+// first one is f. Files read from a path can't be used to build a catalog.
+func CatalogFiles(f TestFile, n int) ([]TestFile, error) {
+	items := []TestFile{f}
+	for i := int64(1); i < int64(n); i++ {
+		switch f := f.(type) {
+		case *RandFile:
+			items = append(items, &RandFile{size: f.size, seed: f.seed + i<<32})
+		case *CustomFile:
+			items = append(items, &CustomFile{spec: f.spec, seed: f.seed + i<<32})
+		default:
+			return nil, fmt.Errorf("Catalogs need random or custom input data")
+		}
+	}
+	return items, nil
+}
+
 // RandFromReader Generates random file from existing reader
 func RandFromReader(randReader *rand.Rand, len int) io.Reader {
 	if randReader == nil {
@@ -160,7 +198,15 @@ func GetFileList(runenv *runtime.RunEnv) ([]TestFile, error) {
 		}
 		return listFiles, nil
 	case "custom":
-		return nil, fmt.Errorf("Custom inputData not implemented yet")
+		specs, err := ParseCustomSpecs(runenv.StringParam("custom_data"))
+		if err != nil {
+			return nil, err
+		}
+		runenv.RecordMessage("Getting file list for custom data: %v", specs)
+		for i, spec := range specs {
+			listFiles = append(listFiles, &CustomFile{spec: spec, seed: int64(i)})
+		}
+		return listFiles, nil
 	default:
 		return nil, fmt.Errorf("Inputdata type not implemented")
 	}
@@ -2,8 +2,8 @@ package utils
 
 import (
 	"context"
-	"fmt"
-	"time"
+	"sync"
+	"sync/atomic"
 
 	"github.com/ipfs/go-blockservice"
 	"github.com/ipfs/go-cid"
@@ -17,12 +17,13 @@ import (
 	format "github.com/ipfs/go-ipld-format"
 	"github.com/ipfs/go-merkledag"
 	unixfile "github.com/ipfs/go-unixfs/file"
-	"github.com/ipfs/go-unixfs/importer/helpers"
 	"github.com/pkg/errors"
 
 	allselector "github.com/hannahhoward/all-selector"
 	"github.com/ipld/go-ipld-prime"
 	cidlink "github.com/ipld/go-ipld-prime/linking/cid"
+	basicnode "github.com/ipld/go-ipld-prime/node/basic"
+	"github.com/ipld/go-ipld-prime/traversal/selector/builder"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
 )
@@ -34,10 +35,13 @@ type GraphsyncNode struct {
 	h             host.Host
 	totalSent     uint64
 	totalReceived uint64
-	numSeeds      int
+	blocksRcvd    uint64
+	settings      AddSettings
+	parallelFetch bool
+	hook          blockHook
 }
 
-func CreateGraphsyncNode(ctx context.Context, h host.Host, bstore blockstore.Blockstore, numSeeds int) (*GraphsyncNode, error) {
+func CreateGraphsyncNode(ctx context.Context, h host.Host, bstore blockstore.Blockstore, settings AddSettings, parallelFetch bool) (*GraphsyncNode, error) {
 	net := network.NewFromLibp2pHost(h)
 	bserv := blockservice.New(bstore, offline.Exchange(bstore))
 	dserv := merkledag.NewDAGService(bserv)
@@ -45,7 +49,7 @@ func CreateGraphsyncNode(ctx context.Context, h host.Host, bstore blockstore.Blo
 		storeutil.LoaderForBlockstore(bstore),
 		storeutil.StorerForBlockstore(bstore),
 	)
-	n := &GraphsyncNode{gs, bstore, dserv, h, 0, 0, numSeeds}
+	n := &GraphsyncNode{gs: gs, blockStore: bstore, dserv: dserv, h: h, settings: settings, parallelFetch: parallelFetch}
 	gs.RegisterBlockSentListener(n.onDataSent)
 	gs.RegisterIncomingBlockHook(n.onDataReceived)
 	gs.RegisterIncomingRequestHook(n.onIncomingRequestHook)
@@ -54,16 +58,11 @@ func CreateGraphsyncNode(ctx context.Context, h host.Host, bstore blockstore.Blo
 
 var selectAll ipld.Node = allselector.AllSelector
 
+// selectRoot selects only the root node of the DAG.
+var selectRoot ipld.Node = builder.NewSelectorSpecBuilder(basicnode.Prototype.Any).Matcher().Node()
+
 func (n *GraphsyncNode) Add(ctx context.Context, fileNode files.Node) (cid.Cid, error) {
-	settings := AddSettings{
-		Layout:    "balanced",
-		Chunker:   "size-262144",
-		RawLeaves: false,
-		NoCopy:    false,
-		HashFunc:  "sha2-256",
-		MaxLinks:  helpers.DefaultLinksPerBlock,
-	}
-	adder, err := NewDAGAdder(ctx, n.dserv, settings)
+	adder, err := NewDAGAdder(ctx, n.dserv, n.settings)
 	if err != nil {
 		return cid.Undef, err
 	}
@@ -79,44 +78,129 @@ func (n *GraphsyncNode) ClearDatastore(ctx context.Context, rootCid cid.Cid) err
 }
 
 func (n *GraphsyncNode) EmitMetrics(recorder MetricsRecorder) error {
-	recorder.Record("data_sent", float64(n.totalSent))
-	recorder.Record("data_rcvd", float64(n.totalReceived))
+	recorder.Record("data_sent", float64(atomic.LoadUint64(&n.totalSent)))
+	recorder.Record("data_rcvd", float64(atomic.LoadUint64(&n.totalReceived)))
 	return nil
 }
 
+func (n *GraphsyncNode) SetBlockHook(hook BlockHook) {
+	n.hook.set(hook)
+}
+
+func (n *GraphsyncNode) Progress() Progress {
+	return Progress{
+		BytesRcvd:  atomic.LoadUint64(&n.totalReceived),
+		BlocksRcvd: atomic.LoadUint64(&n.blocksRcvd),
+	}
+}
+
 func (n *GraphsyncNode) Fetch(ctx context.Context, c cid.Cid, peers []PeerInfo) (files.Node, error) {
-	leechIndex := 0
-	for i := 0; i < len(peers); i++ {
-		if peers[i].Addr.ID == n.h.ID() {
+	seeds := n.seedsFor(peers)
+	if len(seeds) == 0 {
+		return nil, errors.New("no suitable seed found")
+	}
+
+	var err error
+	if n.parallelFetch {
+		err = n.fetchParallel(ctx, c, seeds)
+	} else {
+		err = n.request(ctx, seeds[0], c, selectAll)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	nd, err := n.dserv.Get(ctx, c)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get file %q", c)
+	}
+
+	return unixfile.NewUnixfsFile(ctx, n.dserv, nd)
+}
+
+// seedsFor returns the IDs of the seeds to request the content from.
+func (n *GraphsyncNode) seedsFor(peers []PeerInfo) []peer.ID {
+	var seeds []peer.ID
+	for _, p := range SeedsFor(n.h.ID(), peers) {
+		seeds = append(seeds, p.Addr.ID)
+	}
+	return seeds
+}
+
+// fetchParallel fetches the root node and splits the DAG in the subtrees
+// of the root's links. Subtrees are requested concurrently from all seeds,
+// and a subtree that fails is retried on the next seed.
+func (n *GraphsyncNode) fetchParallel(ctx context.Context, c cid.Cid, seeds []peer.ID) error {
+	var err error
+	for _, p := range seeds {
+		if err = n.request(ctx, p, c, selectRoot); err == nil {
 			break
 		}
-		if peers[i].Nodetp == Leech {
-			leechIndex++
-		}
+	}
+	if err != nil {
+		return errors.Wrapf(err, "failed to fetch root %q", c)
+	}
+	root, err := n.dserv.Get(ctx, c)
+	if err != nil {
+		return err
 	}
 
-	targetSeed := leechIndex % n.numSeeds
-	seedCount := 0
-	var seedIndex = 0
-	for ; seedIndex < len(peers); seedIndex++ {
-		if peers[seedIndex].Nodetp == Seed && peers[seedIndex].Addr.ID != n.h.ID() {
-			if seedCount == targetSeed {
-				break
+	type subtree struct {
+		c        cid.Cid
+		attempts int
+	}
+
+	links := root.Links()
+	// Each queue is large enough to hold every subtree, so retries never block.
+	queues := make([]chan subtree, len(seeds))
+	for i := range queues {
+		queues[i] = make(chan subtree, len(links))
+	}
+	var pending sync.WaitGroup
+	var lk sync.Mutex
+	var fetchErr error
+
+	for i, l := range links {
+		pending.Add(1)
+		queues[i%len(seeds)] <- subtree{c: l.Cid}
+	}
+	for i := range seeds {
+		go func(i int) {
+			for st := range queues[i] {
+				err := n.request(ctx, seeds[i], st.c, selectAll)
+				if err == nil {
+					// Partial responses are not reported as errors.
+					err = Walk(ctx, st.c, n.dserv)
+				}
+				if err == nil {
+					pending.Done()
+					continue
+				}
+
+				st.attempts++
+				if st.attempts >= len(seeds) || ctx.Err() != nil {
+					lk.Lock()
+					fetchErr = errors.Wrapf(err, "failed to fetch subtree %q", st.c)
+					lk.Unlock()
+					pending.Done()
+					continue
+				}
+				queues[(i+1)%len(seeds)] <- st
 			}
-			seedCount++
-		}
+		}(i)
 	}
 
-	if seedCount == len(peers) {
-		return nil, errors.New("no suitable seed found")
+	pending.Wait()
+	for _, q := range queues {
+		close(q)
 	}
-	p := peers[seedIndex].Addr.ID
+	return fetchErr
+}
 
-	start := time.Now()
-	resps, errs := n.gs.Request(ctx, p, cidlink.Link{Cid: c}, selectAll)
+func (n *GraphsyncNode) request(ctx context.Context, p peer.ID, c cid.Cid, sel ipld.Node) error {
+	resps, errs := n.gs.Request(ctx, p, cidlink.Link{Cid: c}, sel)
 	for range resps {
 	}
-	fmt.Println("TIME SINCE START: ", time.Since(start))
 
 	var lastError error
 	for err := range errs {
@@ -124,15 +208,7 @@ func (n *GraphsyncNode) Fetch(ctx context.Context, c cid.Cid, peers []PeerInfo)
 			lastError = err
 		}
 	}
-	if lastError != nil {
-		return nil, lastError
-	}
-	nd, err := n.dserv.Get(ctx, c)
-	if err != nil {
-		return nil, errors.Wrapf(err, "failed to get file %q", c)
-	}
-
-	return unixfile.NewUnixfsFile(ctx, n.dserv, nd)
+	return lastError
 }
 
 func (n *GraphsyncNode) DAGService() format.DAGService {
@@ -146,18 +222,22 @@ func (n *GraphsyncNode) Host() host.Host {
 func (n *GraphsyncNode) EmitKeepAlive(recorder MessageRecorder) error {
 
 	recorder.RecordMessage("I am still alive! Total In: %d - TotalOut: %d",
-		n.totalSent,
-		n.totalReceived)
+		atomic.LoadUint64(&n.totalReceived),
+		atomic.LoadUint64(&n.totalSent))
 
 	return nil
 }
 
 func (n *GraphsyncNode) onDataSent(p peer.ID, request graphsync.RequestData, block graphsync.BlockData) {
-	n.totalSent += block.BlockSizeOnWire()
+	atomic.AddUint64(&n.totalSent, block.BlockSizeOnWire())
 }
 
 func (n *GraphsyncNode) onDataReceived(p peer.ID, request graphsync.ResponseData, block graphsync.BlockData, ha graphsync.IncomingBlockHookActions) {
-	n.totalReceived += block.BlockSizeOnWire()
+	atomic.AddUint64(&n.totalReceived, block.BlockSizeOnWire())
+	atomic.AddUint64(&n.blocksRcvd, 1)
+	if l, ok := block.Link().(cidlink.Link); ok {
+		n.hook.notify(l.Cid, int(block.BlockSize()))
+	}
 }
 
 func (n *GraphsyncNode) onIncomingRequestHook(p peer.ID, request graphsync.RequestData, ha graphsync.IncomingRequestHookActions) {
@@ -7,109 +7,115 @@ import (
 	"io"
 	"net"
 	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ipfs/go-cid"
 	files "github.com/ipfs/go-ipfs-files"
 	ipld "github.com/ipfs/go-ipld-format"
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/peer"
 	ma "github.com/multiformats/go-multiaddr"
 	manet "github.com/multiformats/go-multiaddr/net"
 )
 
+// Port where seeds serve files over HTTP.
+const httpPort = 8080
+
 type HTTPNode struct {
-	h   host.Host
-	svc *http.Server
+	h             host.Host
+	ip            string
+	svc           *http.Server
+	serveOnce     sync.Once
+	serveErr      error
+	parallelFetch bool
+	store         *fileStore
+	stats         streamStats
 }
 
-func CreateHTTPNode(ctx context.Context, h host.Host, nodeTP NodeType) (*HTTPNode, error) {
-	var svr *http.Server
+// CreateHTTPNode creates an HTTP node. Seeds serve their files in the given
+// IP (the data network IP), leeches fetch from the seeds. Leeches becoming
+// seeds start serving when they add the fetched file.
+func CreateHTTPNode(ctx context.Context, h host.Host, nodeTP NodeType, ip string, parallelFetch bool) (*HTTPNode, error) {
+	n := &HTTPNode{
+		h:             h,
+		ip:            ip,
+		parallelFetch: parallelFetch,
+		store:         newFileStore(),
+	}
+
 	switch nodeTP {
 	case Seed:
-		svr = &http.Server{Addr: ":8080"}
-		go svr.ListenAndServe()
-		time.Sleep(1 * time.Second)
-	case Leech:
+		if err := n.serve(); err != nil {
+			return nil, err
+		}
+	case Leech, Passive:
 	default:
 		return nil, errors.New("nodeType NOT supported")
 	}
 
-	return &HTTPNode{
-		h:   h,
-		svc: svr,
-	}, nil
+	return n, nil
 }
 
-func (h *HTTPNode) Add(ctx context.Context, file files.Node) (cid.Cid, error) {
-	f := files.ToFile(file)
-	if f == nil {
-		return cid.Undef, errors.New("node is NOT a File")
-	}
-
-	// associate a random CID with the file here as we don't really care about CIDs for the HTTP Libp2p transfer
-	c, err := randCid()
-	if err != nil {
-		return c, err
-	}
-
-	// set up http server to send file
-	http.HandleFunc(fmt.Sprintf("/%s", c.String()), func(w http.ResponseWriter, r *http.Request) {
-		defer f.Close()
-		_, err := io.Copy(w, f)
+// serve starts the server of the node, if not started yet.
+func (h *HTTPNode) serve() error {
+	h.serveOnce.Do(func() {
+		listener, err := net.Listen("tcp", net.JoinHostPort(h.ip, strconv.Itoa(httpPort)))
 		if err != nil {
-			panic(err)
+			h.serveErr = err
+			return
 		}
+		h.svc = &http.Server{Handler: httpFileHandler(h.store, &h.stats)}
+		go h.svc.Serve(listener)
 	})
+	return h.serveErr
+}
 
-	return c, nil
+func (h *HTTPNode) Add(ctx context.Context, file files.Node) (cid.Cid, error) {
+	if err := h.serve(); err != nil {
+		return cid.Undef, err
+	}
+	return h.store.add(file)
 }
 
-// TODO GET IP
+// Fetch gets the file from the seed assigned to this leech. If parallel fetch
+// is enabled, the file is split into byte ranges fetched in parallel from all seeds.
 func (h *HTTPNode) Fetch(ctx context.Context, c cid.Cid, peers []PeerInfo) (files.Node, error) {
-	seedCount := 0
-	var seedAddrs []ma.Multiaddr
-
-	for _, p := range peers {
-		if p.Nodetp == Seed {
-			seedCount++
-			seedAddrs = p.Addr.Addrs
+	var urls []string
+	for _, s := range SeedsFor(h.h.ID(), peers) {
+		ip, err := peerIP(s.Addr)
+		if err != nil {
+			return nil, err
 		}
+		urls = append(urls, fmt.Sprintf("http://%s/%s", net.JoinHostPort(ip.String(), strconv.Itoa(httpPort)), c.String()))
 	}
-	if seedCount != 1 {
-		return nil, errors.New("http should ONLY have one seed")
-	}
+	return fetchHTTP(ctx, http.DefaultClient, urls, h.parallelFetch, h.store, &h.stats)
+}
 
-	var ip net.IP
-	for _, a := range seedAddrs {
+// peerIP returns the IPv4 address of the peer.
+func peerIP(ai peer.AddrInfo) (net.IP, error) {
+	for _, a := range ai.Addrs {
 		if _, err := a.ValueForProtocol(ma.P_IP4); err == nil {
-			ip, err = manet.ToIP(a)
-			if err != nil {
-				return nil, err
-			}
+			return manet.ToIP(a)
 		}
 	}
-
-	resp, err := http.DefaultClient.Get(fmt.Sprintf("http://%s:8080/%s", ip.String(), c.String()))
-	if err != nil {
-		return nil, err
-	}
-
-	return files.NewReaderFile(resp.Body), nil
+	return nil, fmt.Errorf("no IPv4 address for peer %s", ai.ID)
 }
 
 func (h *HTTPNode) Host() host.Host {
-	return h.Host()
+	return h.h
 }
 
-// NOOP FOR now,
-// #TODO Fix
 func (h *HTTPNode) EmitMetrics(recorder MetricsRecorder) error {
+	h.stats.emit(recorder)
 	return nil
 }
 
-// NO-OP
+// ClearDatastore removes the served file in seeds and the fetched files in leeches.
 func (h *HTTPNode) ClearDatastore(ctx context.Context, rootCid cid.Cid) error {
-	return nil
+	return h.store.clear(rootCid)
 }
 
 // NO-OP
@@ -117,7 +123,136 @@ func (h *HTTPNode) DAGService() ipld.DAGService {
 	return nil
 }
 
-// NO-OP
+func (h *HTTPNode) SetBlockHook(hook BlockHook) {
+	h.stats.hook.set(hook)
+}
+
+func (h *HTTPNode) Progress() Progress {
+	return h.stats.progress()
+}
+
 func (h *HTTPNode) EmitKeepAlive(recorder MessageRecorder) error {
+	h.stats.emitKeepAlive(recorder)
 	return nil
 }
+
+// httpFileHandler serves the files in the store by CID. Range requests are
+// supported.
+func httpFileHandler(store *fileStore, stats *streamStats) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint64(&stats.reqsRcvd, 1)
+		c, err := cid.Decode(r.URL.Path[1:])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f, err := store.open(c)
+		if err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		defer f.Close()
+		http.ServeContent(&countingResponseWriter{w, stats}, r, c.String(), time.Time{}, f)
+	}
+}
+
+// fetchHTTP fetches the file from the first url that answers or, if parallel
+// is set, splits it in byte ranges fetched in parallel from all urls.
+func fetchHTTP(ctx context.Context, client *http.Client, urls []string, parallel bool,
+	store *fileStore, stats *streamStats) (files.Node, error) {
+	if len(urls) == 0 {
+		return nil, errors.New("no seed found")
+	}
+	stats.startFetch()
+
+	if !parallel {
+		var err error
+		for _, url := range urls {
+			var resp *http.Response
+			resp, err = httpGet(ctx, client, url, "", stats)
+			if err == nil {
+				return files.NewReaderFile(&countingReader{resp.Body, stats}), nil
+			}
+		}
+		return nil, err
+	}
+
+	size, err := httpContentLength(ctx, client, urls, stats)
+	if err != nil {
+		return nil, err
+	}
+	path, err := FetchRanges(ctx, size, len(urls), func(ctx context.Context, source int, offset int64, length int64, w io.Writer) error {
+		resp, err := httpGet(ctx, client, urls[source], fmt.Sprintf("bytes=%d-%d", offset, offset+length-1), stats)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		_, err = io.Copy(w, &countingReader{resp.Body, stats})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	store.addFetched(path)
+	return getUnixfsNode(path)
+}
+
+// httpGet requests the url, with the given byte range if not empty.
+func httpGet(ctx context.Context, client *http.Client, url string, byteRange string, stats *streamStats) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if byteRange != "" {
+		req.Header.Set("Range", byteRange)
+	}
+	atomic.AddUint64(&stats.reqsSent, 1)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unexpected status fetching %s: %s", url, resp.Status)
+	}
+	return resp, nil
+}
+
+// httpContentLength gets the size of the file from the first url that answers.
+func httpContentLength(ctx context.Context, client *http.Client, urls []string, stats *streamStats) (int64, error) {
+	var err error
+	for _, url := range urls {
+		var req *http.Request
+		req, err = http.NewRequestWithContext(ctx, http.MethodHead, url, nil)
+		if err != nil {
+			return 0, err
+		}
+		atomic.AddUint64(&stats.reqsSent, 1)
+		var resp *http.Response
+		resp, err = client.Do(req)
+		if err != nil {
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			err = fmt.Errorf("unexpected status fetching %s: %s", url, resp.Status)
+			continue
+		}
+		return resp.ContentLength, nil
+	}
+	return 0, err
+}
+
+// countingResponseWriter counts the bytes of the response body.
+type countingResponseWriter struct {
+	http.ResponseWriter
+	stats *streamStats
+}
+
+func (w *countingResponseWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.stats.sent(n)
+	return n, err
+}
+
+var _ Node = &HTTPNode{}
@@ -21,6 +21,7 @@ import (
 
 	blockstore "github.com/ipfs/go-ipfs-blockstore"
 	config "github.com/ipfs/go-ipfs-config"
+	exchange "github.com/ipfs/go-ipfs-exchange-interface"
 	"github.com/ipfs/go-metrics-interface"
 	icore "github.com/ipfs/interface-go-ipfs-core"
 	"github.com/jbenet/goprocess"
@@ -37,6 +38,7 @@ import (
 	"github.com/ipfs/go-ipfs/repo"
 	"github.com/libp2p/go-libp2p-core/host"
 	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/routing"
 
 	dsync "github.com/ipfs/go-datastore/sync"
 	ci "github.com/libp2p/go-libp2p-core/crypto"
@@ -44,9 +46,11 @@ import (
 
 // IPFSNode represents the node
 type IPFSNode struct {
-	Node  *core.IpfsNode
-	API   icore.CoreAPI
-	Close func() error
+	Node     *core.IpfsNode
+	API      icore.CoreAPI
+	Close    func() error
+	settings AddSettings
+	hook     *blockHook
 }
 
 type NodeConfig struct {
@@ -259,7 +263,7 @@ func setConfig(ctx context.Context, nConfig *NodeConfig, exch ExchangeOpt, DHTen
 }
 
 // CreateIPFSNodeWithConfig constructs and returns an IpfsNode using the given cfg.
-func CreateIPFSNodeWithConfig(ctx context.Context, nConfig *NodeConfig, exch ExchangeOpt, DHTEnabled bool, providingEnabled bool) (*IPFSNode, error) {
+func CreateIPFSNodeWithConfig(ctx context.Context, nConfig *NodeConfig, exch ExchangeOpt, DHTEnabled bool, providingEnabled bool, settings AddSettings) (*IPFSNode, error) {
 	// save this context as the "lifetime" ctx.
 	lctx := ctx
 
@@ -271,9 +275,16 @@ func CreateIPFSNodeWithConfig(ctx context.Context, nConfig *NodeConfig, exch Exc
 
 	n := &core.IpfsNode{}
 
+	// Exchanges put the blocks they receive in the blockstore.
+	hook := &blockHook{}
+	notifyExch := func(mctx helpers.MetricsCtx, lc fx.Lifecycle, h host.Host,
+		rt routing.Routing, bs blockstore.GCBlockstore) exchange.Interface {
+		return exch(mctx, lc, h, rt, blockstore.NewGCBlockstore(&notifyBlockstore{bs, hook}, bs))
+	}
+
 	app := fx.New(
 		// Inject dependencies in the node.
-		setConfig(ctx, nConfig, exch, DHTEnabled, providingEnabled),
+		setConfig(ctx, nConfig, notifyExch, DHTEnabled, providingEnabled),
 
 		fx.NopLogger,
 		fx.Extract(n),
@@ -285,7 +296,7 @@ func CreateIPFSNodeWithConfig(ctx context.Context, nConfig *NodeConfig, exch Exc
 		once.Do(func() {
 			stopErr = app.Stop(context.Background())
 			if stopErr != nil {
-				fmt.Errorf("failure on stop: %w", stopErr)
+				log.Errorf("failure on stop: %v", stopErr)
 			}
 			// Cancel the context _after_ the app has stopped.
 			cancel()
@@ -303,7 +314,7 @@ func CreateIPFSNodeWithConfig(ctx context.Context, nConfig *NodeConfig, exch Exc
 		case <-lctx.Done():
 			err := stopNode()
 			if err != nil {
-				fmt.Errorf("failure on stop: %v", err)
+				log.Errorf("failure on stop: %v", err)
 			}
 		case <-ctx.Done():
 		}
@@ -327,7 +338,7 @@ func CreateIPFSNodeWithConfig(ctx context.Context, nConfig *NodeConfig, exch Exc
 	}
 
 	// Attach the Core API to the constructed node
-	return &IPFSNode{n, api, stopNode}, nil
+	return &IPFSNode{n, api, stopNode, settings, hook}, nil
 }
 
 // ClearDatastore removes a block from the datastore.
@@ -357,26 +368,46 @@ func (n *IPFSNode) ClearDatastore(ctx context.Context, rootCid cid.Cid) error {
 
 // EmitMetrics emits node's metrics for the run
 func (n *IPFSNode) EmitMetrics(recorder MetricsRecorder) error {
-	// TODO: We ned a way of generalizing this for any exchange type
-	bsnode := n.Node.Exchange.(*bs.Bitswap)
-	stats, err := bsnode.Stat()
+	var dataSent, dataRcvd uint64
+
+	gsExch, isGraphsync := n.Node.Exchange.(*GraphsyncExchange)
+	bsnode, isBitswap := n.Node.Exchange.(*bs.Bitswap)
+	if isGraphsync {
+		// The hybrid exchange has bitswap as fallback.
+		bsnode = gsExch.Bitswap()
+		isBitswap = bsnode != nil
+
+		gsSent, gsRcvd := gsExch.Stats()
+		recorder.Record("gs_data_sent", float64(gsSent))
+		recorder.Record("gs_data_rcvd", float64(gsRcvd))
+		dataSent += gsSent
+		dataRcvd += gsRcvd
+		gsExch.ResetStatCounters()
+	}
 
-	if err != nil {
-		return fmt.Errorf("Error getting stats from Bitswap: %w", err)
+	if isBitswap {
+		stats, err := bsnode.Stat()
+		if err != nil {
+			return fmt.Errorf("Error getting stats from Bitswap: %w", err)
+		}
+
+		recorder.Record("msgs_rcvd", float64(stats.MessagesReceived))
+		recorder.Record("block_data_rcvd", float64(stats.BlockDataReceived))
+		recorder.Record("dup_data_rcvd", float64(stats.DupDataReceived))
+		recorder.Record("blks_sent", float64(stats.BlocksSent))
+		recorder.Record("blks_rcvd", float64(stats.BlocksReceived))
+		recorder.Record("dup_blks_rcvd", float64(stats.DupBlksReceived))
+		recorder.Record("wants_rcvd", float64(stats.WantsRecvd))
+		recorder.Record("want_blocks_rcvd", float64(stats.WantBlocksRecvd))
+		recorder.Record("want_haves_rcvd", float64(stats.WantHavesRecvd))
+		recorder.Record("stream_data_sent", float64(stats.StreamDataSent))
+		dataSent += stats.DataSent
+		dataRcvd += stats.DataReceived
+		bsnode.ResetStatCounters()
 	}
 
-	recorder.Record("msgs_rcvd", float64(stats.MessagesReceived))
-	recorder.Record("data_sent", float64(stats.DataSent))
-	recorder.Record("data_rcvd", float64(stats.DataReceived))
-	recorder.Record("block_data_rcvd", float64(stats.BlockDataReceived))
-	recorder.Record("dup_data_rcvd", float64(stats.DupDataReceived))
-	recorder.Record("blks_sent", float64(stats.BlocksSent))
-	recorder.Record("blks_rcvd", float64(stats.BlocksReceived))
-	recorder.Record("dup_blks_rcvd", float64(stats.DupBlksReceived))
-	recorder.Record("wants_rcvd", float64(stats.WantsRecvd))
-	recorder.Record("want_blocks_rcvd", float64(stats.WantBlocksRecvd))
-	recorder.Record("want_haves_rcvd", float64(stats.WantHavesRecvd))
-	recorder.Record("stream_data_sent", float64(stats.StreamDataSent))
+	recorder.Record("data_sent", float64(dataSent))
+	recorder.Record("data_rcvd", float64(dataRcvd))
 
 	// IPFS Node Stats
 	bwTotal := n.Node.Reporter.GetBandwidthTotals()
@@ -387,7 +418,6 @@ func (n *IPFSNode) EmitMetrics(recorder MetricsRecorder) error {
 
 	// Restart all counters for the next test.
 	n.Node.Reporter.Reset()
-	n.Node.Exchange.(*bs.Bitswap).ResetStatCounters()
 
 	// A few other metrics that could be collected.
 	// GetBandwidthForPeer(peer.ID) Stats
@@ -399,12 +429,25 @@ func (n *IPFSNode) EmitMetrics(recorder MetricsRecorder) error {
 	return nil
 }
 
+// Add imports the file with the same DAG adder used by the other node types
+// so that the resulting DAG only depends on the add settings. The root is
+// pinned and provided as the CoreAPI would do.
 func (n *IPFSNode) Add(ctx context.Context, tmpFile files.Node) (cid.Cid, error) {
-	path, err := n.API.Unixfs().Add(ctx, tmpFile)
+	adder, err := NewDAGAdder(ctx, n.Node.DAG, n.settings)
 	if err != nil {
 		return cid.Undef, err
 	}
-	return path.Cid(), nil
+	ipldNode, err := adder.Add(tmpFile)
+	if err != nil {
+		return cid.Undef, err
+	}
+	if err := n.API.Pin().Add(ctx, path.IpfsPath(ipldNode.Cid())); err != nil {
+		return cid.Undef, err
+	}
+	if err := n.Node.Provider.Provide(ipldNode.Cid()); err != nil {
+		return cid.Undef, err
+	}
+	return ipldNode.Cid(), nil
 }
 
 func (n *IPFSNode) Fetch(ctx context.Context, c cid.Cid, _ []PeerInfo) (files.Node, error) {
@@ -420,6 +463,29 @@ func (n *IPFSNode) Host() host.Host {
 	return n.Node.PeerHost
 }
 
+func (n *IPFSNode) SetBlockHook(hook BlockHook) {
+	n.hook.set(hook)
+}
+
+// Progress adds up the data received through graphsync and bitswap.
+func (n *IPFSNode) Progress() Progress {
+	var p Progress
+	bsnode, isBitswap := n.Node.Exchange.(*bs.Bitswap)
+	if gsExch, ok := n.Node.Exchange.(*GraphsyncExchange); ok {
+		bsnode = gsExch.Bitswap()
+		isBitswap = bsnode != nil
+		_, p.BytesRcvd = gsExch.Stats()
+		p.BlocksRcvd = gsExch.BlocksReceived()
+	}
+	if isBitswap {
+		if stats, err := bsnode.Stat(); err == nil {
+			p.BytesRcvd += stats.DataReceived
+			p.BlocksRcvd += stats.BlocksReceived
+		}
+	}
+	return p
+}
+
 func (n *IPFSNode) EmitKeepAlive(recorder MessageRecorder) error {
 
 	recorder.RecordMessage("I am still alive! Total In: %d - TotalOut: %d",
@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIPFSNodeTransfer(t *testing.T) {
+	for _, exchange := range []string{"bitswap", "graphsync", "hybrid"} {
+		exchange := exchange
+		t.Run(exchange, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			seed := newTestIPFSNode(ctx, t, exchange)
+			leech := newTestIPFSNode(ctx, t, exchange)
+			testTransfer(ctx, t, seed, leech)
+		})
+	}
+}
+
+func newTestIPFSNode(ctx context.Context, t *testing.T, exchange string) *IPFSNode {
+	t.Helper()
+	exch, err := SetExchange(ctx, exchange)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nConfig, err := GenerateAddrInfo("127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := CreateIPFSNodeWithConfig(ctx, nConfig, exch, false, false, DefaultAddSettings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.Close() })
+	return n
+}
@@ -2,117 +2,104 @@ package utils
 
 import (
 	"context"
-	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
-	"math/rand"
 	"net/http"
-	"time"
+	"sync"
 
 	"github.com/ipfs/go-cid"
 	files "github.com/ipfs/go-ipfs-files"
 	ipld "github.com/ipfs/go-ipld-format"
 	"github.com/libp2p/go-libp2p-core/host"
-	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/libp2p/go-libp2p-core/metrics"
 	gostream "github.com/libp2p/go-libp2p-gostream"
 	p2phttp "github.com/libp2p/go-libp2p-http"
-	mh "github.com/multiformats/go-multihash"
 )
 
 type Libp2pHTTPNode struct {
-	client *http.Client
-	h      host.Host
-	svr    *http.Server
+	client        *http.Client
+	h             host.Host
+	svr           *http.Server
+	serveOnce     sync.Once
+	serveErr      error
+	parallelFetch bool
+	store         *fileStore
+	stats         streamStats
+	hostStats     *hostStats
 }
 
-func CreateLibp2pHTTPNode(ctx context.Context, h host.Host, nodeTP NodeType) (*Libp2pHTTPNode, error) {
+// CreateLibp2pHTTPNode creates an HTTP over libp2p node. The bandwidth counter
+// must be the one attached to the host, it is used to report the traffic of the node.
+// Leeches becoming seeds start serving when they add the fetched file.
+func CreateLibp2pHTTPNode(ctx context.Context, h host.Host, bwc *metrics.BandwidthCounter, nodeTP NodeType, parallelFetch bool) (*Libp2pHTTPNode, error) {
+	n := &Libp2pHTTPNode{
+		h:             h,
+		parallelFetch: parallelFetch,
+		store:         newFileStore(),
+		hostStats:     newHostStats(h, bwc),
+	}
+
 	switch nodeTP {
 	case Seed:
-		// Server
-		listener, err := gostream.Listen(h, p2phttp.DefaultP2PProtocol)
-		if err != nil {
+		if err := n.serve(); err != nil {
 			return nil, err
 		}
-		// start an http server on port 8080
-		svr := &http.Server{}
-		go svr.Serve(listener)
-		time.Sleep(1 * time.Second)
-		return &Libp2pHTTPNode{
-			h:   h,
-			svr: svr,
-		}, nil
 	case Leech:
 		tr := &http.Transport{}
 		tr.RegisterProtocol("libp2p", p2phttp.NewTransport(h))
-		client := &http.Client{Transport: tr}
-
-		return &Libp2pHTTPNode{
-			client: client,
-			h:      h,
-		}, nil
+		n.client = &http.Client{Transport: tr}
+	case Passive:
 	default:
 		return nil, errors.New("nodeType NOT supported")
 	}
+	return n, nil
 }
 
-func (l *Libp2pHTTPNode) Add(ctx context.Context, file files.Node) (cid.Cid, error) {
-	f := files.ToFile(file)
-	if f == nil {
-		return cid.Undef, errors.New("node is NOT a File")
-	}
-
-	c, err := randCid()
-	if err != nil {
-		return cid.Undef, err
-	}
-
-	// set up http server to send file
-	http.HandleFunc(fmt.Sprintf("/%s", c.String()), func(w http.ResponseWriter, r *http.Request) {
-		defer f.Close()
-		_, err := io.Copy(w, f)
+// serve starts the server of the node, if not started yet.
+func (l *Libp2pHTTPNode) serve() error {
+	l.serveOnce.Do(func() {
+		listener, err := gostream.Listen(l.h, p2phttp.DefaultP2PProtocol)
 		if err != nil {
-			panic(err)
+			l.serveErr = err
+			return
 		}
+		l.svr = &http.Server{Handler: httpFileHandler(l.store, &l.stats)}
+		go l.svr.Serve(listener)
 	})
-
-	return c, nil
+	return l.serveErr
 }
 
-func (l *Libp2pHTTPNode) Fetch(ctx context.Context, cid cid.Cid, peers []PeerInfo) (files.Node, error) {
-	seedCount := 0
-	var seed peer.ID
-
-	for _, p := range peers {
-		if p.Nodetp == Seed {
-			seedCount++
-			seed = p.Addr.ID
-		}
-	}
-	if seedCount != 1 {
-		return nil, errors.New("libp2p http should ONLY have one seed")
+func (l *Libp2pHTTPNode) Add(ctx context.Context, file files.Node) (cid.Cid, error) {
+	if err := l.serve(); err != nil {
+		return cid.Undef, err
 	}
+	return l.store.add(file)
+}
 
-	resp, err := l.client.Get(fmt.Sprintf("libp2p://%s/%s", seed.String(), cid.String()))
-	if err != nil {
-		return nil, err
+// Fetch gets the file from the seed assigned to this leech. If parallel fetch
+// is enabled, the file is split into byte ranges fetched in parallel from all seeds.
+func (l *Libp2pHTTPNode) Fetch(ctx context.Context, cid cid.Cid, peers []PeerInfo) (files.Node, error) {
+	var urls []string
+	for _, s := range SeedsFor(l.h.ID(), peers) {
+		urls = append(urls, fmt.Sprintf("libp2p://%s/%s", s.Addr.ID.String(), cid.String()))
 	}
-
-	return files.NewReaderFile(resp.Body), nil
+	return fetchHTTP(ctx, l.client, urls, l.parallelFetch, l.store, &l.stats)
 }
 
 func (l *Libp2pHTTPNode) Host() host.Host {
 	return l.h
 }
 
+// ClearDatastore removes the served file in seeds and the fetched files in leeches.
 func (l *Libp2pHTTPNode) ClearDatastore(ctx context.Context, rootCid cid.Cid) error {
-
-	return nil
+	return l.store.clear(rootCid)
 }
 
-// NOOP FOR now,
-// #TODO Fix
+// EmitMetrics records the traffic of the host and the requests and fetch
+// timings of the node.
 func (l *Libp2pHTTPNode) EmitMetrics(recorder MetricsRecorder) error {
+	l.hostStats.emit(recorder)
+	l.stats.emitRequests(recorder)
 	return nil
 }
 
@@ -121,19 +108,15 @@ func (l *Libp2pHTTPNode) DAGService() ipld.DAGService {
 	return nil
 }
 
-// NO-OP
-func (l *Libp2pHTTPNode) EmitKeepAlive(recorder MessageRecorder) error {
-	return nil
+func (l *Libp2pHTTPNode) SetBlockHook(hook BlockHook) {
+	l.stats.hook.set(hook)
 }
 
-func randCid() (cid.Cid, error) {
-	buf := make([]byte, binary.MaxVarintLen64)
-	u := rand.Uint64()
-	binary.PutUvarint(buf, u)
-	h1, err := mh.Sum(buf, mh.SHA2_256, -1)
-	if err != nil {
-		return cid.Undef, err
-	}
+func (l *Libp2pHTTPNode) Progress() Progress {
+	return l.stats.progress()
+}
 
-	return cid.NewCidV1(cid.Raw, h1), nil
+func (l *Libp2pHTTPNode) EmitKeepAlive(recorder MessageRecorder) error {
+	l.hostStats.emitKeepAlive(recorder)
+	return nil
 }
@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/testground/sdk-go/network"
+	"github.com/testground/sdk-go/ptypes"
+	"github.com/testground/sdk-go/runtime"
+)
+
+// Sources of the latency between pairs of nodes.
+const (
+	PairwiseNone    = "none"
+	PairwiseMatrix  = "matrix"
+	PairwiseRegions = "regions"
+)
+
+// Regions assigns synthetic geographic regions to nodes and sets the latency
+// between regions. For example:
+//
+//	{"nodes": {"seed": "eu", "leech": "us"}, "latency_ms": {"eu": {"eu": 5, "us": 80}, "us": {"us": 10}}}
+type Regions struct {
+	// Nodes maps a group ID, or a node type (seed, leech or passive) for
+	// nodes without a group in the map, to its region.
+	Nodes map[string]string `json:"nodes"`
+	// Latencies between regions. Latencies are symmetric, so only one of
+	// both directions needs to be set.
+	Latencies map[string]map[string]int `json:"latency_ms"`
+}
+
+// region returns the region of the node.
+func (r *Regions) region(inf PeerInfo) (string, error) {
+	if region, ok := r.Nodes[inf.Group]; ok && inf.Group != "" {
+		return region, nil
+	}
+	if region, ok := r.Nodes[strings.ToLower(inf.Nodetp.String())]; ok {
+		return region, nil
+	}
+	return "", fmt.Errorf("No region for %s %d of group %q", inf.Nodetp, inf.Tpindex, inf.Group)
+}
+
+func (r *Regions) latency(from string, to string) (time.Duration, error) {
+	if l, ok := r.Latencies[from][to]; ok {
+		return time.Duration(l) * time.Millisecond, nil
+	}
+	if l, ok := r.Latencies[to][from]; ok {
+		return time.Duration(l) * time.Millisecond, nil
+	}
+	return 0, fmt.Errorf("No latency between regions %q and %q", from, to)
+}
+
+// pairwiseRules returns a rule for every other peer with the latency of the
+// link between self and the peer, set by the pairwise_latency param. The rest
+// of the link shape is the default one.
+func pairwiseRules(runenv *runtime.RunEnv, self PeerInfo, peers []PeerInfo,
+	shape network.LinkShape, jitterPct int) ([]network.LinkRule, error) {
+	if !runenv.IsParamSet("pairwise_latency") {
+		return nil, nil
+	}
+
+	var latency func(PeerInfo) (time.Duration, error)
+	switch mode := runenv.StringParam("pairwise_latency"); mode {
+	case PairwiseNone:
+		return nil, nil
+	case PairwiseMatrix:
+		matrix, err := readLatencyMatrix(runenv.StringParam("latency_matrix"))
+		if err != nil {
+			return nil, err
+		}
+		latency = func(p PeerInfo) (time.Duration, error) {
+			// Rows and columns are sequence numbers, starting from 1.
+			if int(self.Seq) > len(matrix) || int(p.Seq) > len(matrix[self.Seq-1]) {
+				return 0, fmt.Errorf("No latency from node %d to node %d in the latency matrix", self.Seq, p.Seq)
+			}
+			return matrix[self.Seq-1][p.Seq-1], nil
+		}
+	case PairwiseRegions:
+		var regions Regions
+		if err := json.Unmarshal([]byte(runenv.StringParam("regions")), &regions); err != nil {
+			return nil, fmt.Errorf("Could not parse regions: %w", err)
+		}
+		selfRegion, err := regions.region(self)
+		if err != nil {
+			return nil, err
+		}
+		latency = func(p PeerInfo) (time.Duration, error) {
+			region, err := regions.region(p)
+			if err != nil {
+				return 0, err
+			}
+			return regions.latency(selfRegion, region)
+		}
+	default:
+		return nil, fmt.Errorf("Unknown pairwise latency %q", mode)
+	}
+
+	var rules []network.LinkRule
+	for _, p := range peers {
+		if p.Addr.ID == self.Addr.ID {
+			continue
+		}
+		l, err := latency(p)
+		if err != nil {
+			return nil, err
+		}
+		ip, err := peerIP(p.Addr)
+		if err != nil {
+			return nil, err
+		}
+		rule := network.LinkRule{
+			LinkShape: shape,
+			Subnet:    ptypes.IPNet{IPNet: net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}},
+		}
+		rule.Latency = l
+		rule.Jitter = (time.Duration(jitterPct) * l) / 100
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// readLatencyMatrix reads a matrix of latencies in ms, one row per line, with
+// values separated by spaces or commas. Empty lines and lines starting with #
+// are ignored.
+func readLatencyMatrix(path string) ([][]time.Duration, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("Could not read latency matrix: %w", err)
+	}
+	defer f.Close()
+
+	var matrix [][]time.Duration
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		var row []time.Duration
+		for _, v := range strings.FieldsFunc(line, func(r rune) bool {
+			return r == ',' || r == ' ' || r == '\t'
+		}) {
+			ms, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid latency %q in the latency matrix", v)
+			}
+			row = append(row, time.Duration(ms*float64(time.Millisecond)))
+		}
+		matrix = append(matrix, row)
+	}
+	return matrix, scanner.Err()
+}
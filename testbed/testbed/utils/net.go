@@ -2,6 +2,7 @@ package utils
 
 import (
 	"context"
+	"net"
 	"strings"
 	"time"
 
@@ -10,24 +11,49 @@ import (
 	"github.com/testground/sdk-go/sync"
 )
 
+// Impairments are the percentages of packets lost, corrupted, reordered and
+// duplicated in the links of a node.
+type Impairments struct {
+	LossPct      float64
+	CorruptPct   float64
+	ReorderPct   float64
+	DuplicatePct float64
+}
+
+// NetworkClient shapes the links of a node. *network.Client shapes them
+// through the Testground sidecar.
+type NetworkClient interface {
+	WaitNetworkInitialized(ctx context.Context) error
+	ConfigureNetwork(ctx context.Context, config *network.Config) error
+	MustGetDataNetworkIP() net.IP
+}
+
 // SetupNetwork instructs the sidecar (if enabled) to setup the network for this
-// test case.
+// test case. It returns the config applied, or nil without sidecar.
 func SetupNetwork(ctx context.Context, runenv *runtime.RunEnv,
-	nwClient *network.Client, nodetp NodeType, tpindex int, baseLatency time.Duration,
-	bandwidth int, jitterPct int) error {
+	nwClient NetworkClient, nodetp NodeType, tpindex int, baseLatency time.Duration,
+	bandwidth int, jitterPct int, impairments Impairments, self PeerInfo, peers []PeerInfo) (*network.Config, error) {
 
 	if !runenv.TestSidecar {
-		return nil
+		return nil, nil
 	}
 
 	// Wait for the network to be initialized.
 	if err := nwClient.WaitNetworkInitialized(ctx); err != nil {
-		return err
+		return nil, err
 	}
 
 	latency, err := getLatency(runenv, nodetp, tpindex, baseLatency)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	bandwidth, err = getBandwidth(runenv, nodetp, tpindex, bandwidth)
+	if err != nil {
+		return nil, err
+	}
+	jitterPct, err = getJitter(runenv, nodetp, tpindex, jitterPct)
+	if err != nil {
+		return nil, err
 	}
 
 	cfg := &network.Config{
@@ -38,14 +64,25 @@ func SetupNetwork(ctx context.Context, runenv *runtime.RunEnv,
 			Latency:   latency,
 			Bandwidth: uint64(bandwidth) * 1024 * 1024,
 			Jitter:    (time.Duration(jitterPct) * latency) / 100,
+			Loss:      float32(impairments.LossPct),
+			Corrupt:   float32(impairments.CorruptPct),
+			Reorder:   float32(impairments.ReorderPct),
+			Duplicate: float32(impairments.DuplicatePct),
 		},
 		CallbackState:  sync.State("network-configured"),
 		CallbackTarget: runenv.TestInstanceCount,
 	}
+	// Links to specific peers may have a different latency.
+	cfg.Rules, err = pairwiseRules(runenv, self, peers, cfg.Default, jitterPct)
+	if err != nil {
+		return nil, err
+	}
 
 	runenv.RecordMessage("%s %d has %s latency (%d%% jitter) and %dMB bandwidth", nodetp, tpindex, latency, jitterPct, bandwidth)
+	runenv.RecordMessage("%s %d has %g%% loss, %g%% corruption, %g%% reordering and %g%% duplication", nodetp, tpindex,
+		impairments.LossPct, impairments.CorruptPct, impairments.ReorderPct, impairments.DuplicatePct)
 
-	return nwClient.ConfigureNetwork(ctx, cfg)
+	return cfg, nwClient.ConfigureNetwork(ctx, cfg)
 }
 
 // If there's a latency specific to the node type, overwrite the default latency
@@ -58,6 +95,37 @@ func getLatency(runenv *runtime.RunEnv, nodetp NodeType, tpindex int, baseLatenc
 	return baseLatency, nil
 }
 
+// getTypeLatency adds the latency specific to the node type to the base latency.
+// See getTypeParam for the format of the parameter.
+func getTypeLatency(runenv *runtime.RunEnv, param string, tpindex int, baseLatency time.Duration) (time.Duration, error) {
+	latency, ok, err := getTypeParam(runenv, param, tpindex)
+	if err != nil || !ok {
+		return baseLatency, err
+	}
+	return baseLatency + time.Duration(latency)*time.Millisecond, nil
+}
+
+// If there's a bandwidth specific to the node type (seed_bandwidth_mb,
+// leech_bandwidth_mb or passive_bandwidth_mb), it replaces the default bandwidth.
+func getBandwidth(runenv *runtime.RunEnv, nodetp NodeType, tpindex int, baseBandwidth int) (int, error) {
+	bandwidth, ok, err := getTypeParam(runenv, strings.ToLower(nodetp.String())+"_bandwidth_mb", tpindex)
+	if err != nil || !ok {
+		return baseBandwidth, err
+	}
+	return int(bandwidth), nil
+}
+
+// If there's a jitter specific to the node type (seed_jitter_pct,
+// leech_jitter_pct or passive_jitter_pct), it replaces the default jitter.
+func getJitter(runenv *runtime.RunEnv, nodetp NodeType, tpindex int, baseJitterPct int) (int, error) {
+	jitterPct, ok, err := getTypeParam(runenv, strings.ToLower(nodetp.String())+"_jitter_pct", tpindex)
+	if err != nil || !ok {
+		return baseJitterPct, err
+	}
+	return int(jitterPct), nil
+}
+
+// getTypeParam returns the value of a parameter specific to a node type.
 // If the parameter is a comma-separated list, each value in the list
 // corresponds to the type index. For example:
 // seed_latency_ms=100,200,400
@@ -65,30 +133,31 @@ func getLatency(runenv *runtime.RunEnv, nodetp NodeType, tpindex int, baseLatenc
 // - the first seed has 100ms latency
 // - the second seed has 200ms latency
 // - the third seed has 400ms latency
-// - any subsequent seeds have defaultLatency
-func getTypeLatency(runenv *runtime.RunEnv, param string, tpindex int, baseLatency time.Duration) (time.Duration, error) {
-	// No type specific latency set, just return the default
+// - any subsequent seeds have the default latency
+// It returns false if there's no value for the type index.
+func getTypeParam(runenv *runtime.RunEnv, param string, tpindex int) (uint64, bool, error) {
+	// No type specific value set, use the default
 	if !runenv.IsParamSet(param) {
-		return baseLatency, nil
+		return 0, false, nil
 	}
 
 	// Not a comma-separated list, interpret the value as an int and apply
-	// the same latency to all peers of this type
+	// the same value to all peers of this type
 	if !strings.Contains(runenv.StringParam(param), ",") {
-		return baseLatency + time.Duration(runenv.IntParam(param)) * time.Millisecond, nil
+		return uint64(runenv.IntParam(param)), true, nil
 	}
 
 	// Comma separated list, the position in the list corresponds to the
 	// type index
-	latencies, err := ParseIntArray(runenv.StringParam(param))
+	values, err := ParseIntArray(runenv.StringParam(param))
 	if err != nil {
-		return 0, err
+		return 0, false, err
 	}
-	if tpindex < len(latencies) {
-		return baseLatency + time.Duration(latencies[tpindex]) * time.Millisecond, nil
+	if tpindex < len(values) {
+		return values[tpindex], true, nil
 	}
 
-	// More peers of this type than entries in the list. Return the default
-	// latency for peers not covered by list entries
-	return baseLatency, nil
+	// More peers of this type than entries in the list. Use the default
+	// for peers not covered by list entries
+	return 0, false, nil
 }
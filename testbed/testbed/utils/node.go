@@ -14,6 +14,12 @@ import (
 type PeerInfo struct {
 	Addr   peer.AddrInfo
 	Nodetp NodeType
+	// Sequence number of the node in the test, starting from 1.
+	Seq int64
+	// Group of the node and index among the nodes of its type in the group
+	// (or in the test if nodes types are not set per group).
+	Group   string
+	Tpindex int
 }
 
 type Node interface {
@@ -24,6 +30,15 @@ type Node interface {
 	Host() host.Host
 	DAGService() ipld.DAGService
 	EmitKeepAlive(recorder MessageRecorder) error
+	Progress() Progress
+	SetBlockHook(hook BlockHook)
+}
+
+// Progress is a snapshot of the data received by a node so far.
+type Progress struct {
+	BytesRcvd uint64
+	// BlocksRcvd is 0 for nodes that don't exchange blocks.
+	BlocksRcvd uint64
 }
 
 type MetricsRecorder interface {
@@ -33,3 +48,31 @@ type MetricsRecorder interface {
 type MessageRecorder interface {
 	RecordMessage(msg string, a ...interface{})
 }
+
+// SeedsFor returns the seeds in the list of peers other than self. The list
+// is rotated according to the index of self among the leeches, so that
+// leeches pick different seeds deterministically.
+func SeedsFor(self peer.ID, peers []PeerInfo) []PeerInfo {
+	leechIndex := 0
+	for _, p := range peers {
+		if p.Addr.ID == self {
+			break
+		}
+		if p.Nodetp == Leech {
+			leechIndex++
+		}
+	}
+
+	var seeds []PeerInfo
+	for _, p := range peers {
+		if p.Nodetp == Seed && p.Addr.ID != self {
+			seeds = append(seeds, p)
+		}
+	}
+	if len(seeds) == 0 {
+		return nil
+	}
+
+	target := leechIndex % len(seeds)
+	return append(seeds[target:len(seeds):len(seeds)], seeds[:target]...)
+}
@@ -0,0 +1,193 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+	files "github.com/ipfs/go-ipfs-files"
+	"github.com/libp2p/go-libp2p"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/peer"
+)
+
+const testFileSize = 1 << 20
+
+// recorder keeps the last value of every metric.
+type recorder map[string]float64
+
+func (r recorder) Record(key string, value float64) {
+	r[key] = value
+}
+
+// nodeConstructor creates a node of the given type on the host. The bandwidth
+// counter is the one attached to the host.
+type nodeConstructor func(ctx context.Context, h host.Host, bwc *metrics.BandwidthCounter, tp NodeType) (Node, error)
+
+// newBlockNode returns a constructor of nodes exchanging blocks, on top of
+// an in-memory blockstore.
+func newBlockNode(create func(ctx context.Context, h host.Host, bstore blockstore.Blockstore) (Node, error)) nodeConstructor {
+	return func(ctx context.Context, h host.Host, _ *metrics.BandwidthCounter, _ NodeType) (Node, error) {
+		dStore, err := CreateDatastore(false, 0)
+		if err != nil {
+			return nil, err
+		}
+		bstore, err := CreateBlockstore(ctx, dStore)
+		if err != nil {
+			return nil, err
+		}
+		return create(ctx, h, bstore)
+	}
+}
+
+var nodeTypes = []struct {
+	name string
+	new  nodeConstructor
+}{
+	{"bitswap", newBlockNode(func(ctx context.Context, h host.Host, bstore blockstore.Blockstore) (Node, error) {
+		return CreateBitswapNode(ctx, h, bstore, DefaultAddSettings)
+	})},
+	{"graphsync", newBlockNode(func(ctx context.Context, h host.Host, bstore blockstore.Blockstore) (Node, error) {
+		return CreateGraphsyncNode(ctx, h, bstore, DefaultAddSettings, false)
+	})},
+	{"graphsync parallel", newBlockNode(func(ctx context.Context, h host.Host, bstore blockstore.Blockstore) (Node, error) {
+		return CreateGraphsyncNode(ctx, h, bstore, DefaultAddSettings, true)
+	})},
+	{"libp2pHTTP", func(ctx context.Context, h host.Host, bwc *metrics.BandwidthCounter, tp NodeType) (Node, error) {
+		return CreateLibp2pHTTPNode(ctx, h, bwc, tp, false)
+	}},
+	{"libp2pHTTP parallel", func(ctx context.Context, h host.Host, bwc *metrics.BandwidthCounter, tp NodeType) (Node, error) {
+		return CreateLibp2pHTTPNode(ctx, h, bwc, tp, true)
+	}},
+	{"rawLibp2p", func(ctx context.Context, h host.Host, bwc *metrics.BandwidthCounter, tp NodeType) (Node, error) {
+		return CreateRawLibp2pNode(ctx, h, bwc, tp, false)
+	}},
+	{"rawLibp2p parallel", func(ctx context.Context, h host.Host, bwc *metrics.BandwidthCounter, tp NodeType) (Node, error) {
+		return CreateRawLibp2pNode(ctx, h, bwc, tp, true)
+	}},
+	{"http", func(ctx context.Context, h host.Host, _ *metrics.BandwidthCounter, tp NodeType) (Node, error) {
+		return CreateHTTPNode(ctx, h, tp, "127.0.0.1", false)
+	}},
+}
+
+func TestNodeTransfer(t *testing.T) {
+	for _, tt := range nodeTypes {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+
+			seed := newTestNode(ctx, t, tt.new, Seed)
+			leech := newTestNode(ctx, t, tt.new, Leech)
+			testTransfer(ctx, t, seed, leech)
+		})
+	}
+}
+
+// testTransfer adds a file on the seed, fetches it from the leech and checks
+// the metrics of both nodes. Once their datastores are cleared, the file
+// can't be fetched anymore.
+func testTransfer(ctx context.Context, t *testing.T, seed, leech Node) {
+	data, err := ioutil.ReadAll(SeededRandReader(testFileSize, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := seed.Add(ctx, files.NewBytesFile(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seedInfo := peer.AddrInfo{ID: seed.Host().ID(), Addrs: seed.Host().Addrs()}
+	if err := leech.Host().Connect(ctx, seedInfo); err != nil {
+		t.Fatal(err)
+	}
+	peers := []PeerInfo{
+		{Addr: seedInfo, Nodetp: Seed, Seq: 1},
+		{Addr: peer.AddrInfo{ID: leech.Host().ID(), Addrs: leech.Host().Addrs()}, Nodetp: Leech, Seq: 2},
+	}
+
+	got := fetchBytes(ctx, t, leech, c, peers)
+	if !bytes.Equal(got, data) {
+		t.Fatalf("fetched %d bytes that don't match the %d bytes added", len(got), len(data))
+	}
+	if p := leech.Progress(); p.BytesRcvd == 0 {
+		t.Errorf("no progress after fetching: %+v", p)
+	}
+
+	// Bandwidth counters of the hosts are updated every second.
+	time.Sleep(1500 * time.Millisecond)
+	seedMetrics, leechMetrics := recorder{}, recorder{}
+	if err := seed.EmitMetrics(seedMetrics); err != nil {
+		t.Fatal(err)
+	}
+	if err := leech.EmitMetrics(leechMetrics); err != nil {
+		t.Fatal(err)
+	}
+	if seedMetrics["data_sent"] == 0 {
+		t.Errorf("seed sent no data: %v", seedMetrics)
+	}
+	if leechMetrics["data_rcvd"] == 0 {
+		t.Errorf("leech received no data: %v", leechMetrics)
+	}
+
+	if err := seed.ClearDatastore(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	if err := leech.ClearDatastore(ctx, c); err != nil {
+		t.Fatal(err)
+	}
+	fctx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if f, err := leech.Fetch(fctx, c, peers); err == nil {
+		if _, err := ioutil.ReadAll(files.ToFile(f)); err == nil {
+			t.Fatal("fetched the file after clearing the datastores")
+		}
+	}
+}
+
+func fetchBytes(ctx context.Context, t *testing.T, n Node, c cid.Cid, peers []PeerInfo) []byte {
+	t.Helper()
+	f, err := n.Fetch(ctx, c, peers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := files.ToFile(f)
+	if file == nil {
+		t.Fatalf("fetched %T instead of a file", f)
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func newTestNode(ctx context.Context, t *testing.T, newNode nodeConstructor, tp NodeType) Node {
+	t.Helper()
+	h, bwc := newTestHost(ctx, t)
+	n, err := newNode(ctx, h, bwc, tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+// newTestHost creates a host listening on loopback, closed with the test.
+func newTestHost(ctx context.Context, t *testing.T) (host.Host, *metrics.BandwidthCounter) {
+	t.Helper()
+	bwc := metrics.NewBandwidthCounter()
+	h, err := libp2p.New(ctx,
+		libp2p.ListenAddrStrings("/ip4/127.0.0.1/tcp/0"),
+		libp2p.BandwidthReporter(bwc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { h.Close() })
+	return h, bwc
+}
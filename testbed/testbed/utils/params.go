@@ -18,3 +18,16 @@ func ParseIntArray(value string) ([]uint64, error) {
 	}
 	return ints, nil
 }
+
+func ParseFloatArray(value string) ([]float64, error) {
+	var floats []float64
+	strs := strings.Split(value, ",")
+	for _, str := range strs {
+		num, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return nil, fmt.Errorf("Could not convert '%s' to float", str)
+		}
+		floats = append(floats, num)
+	}
+	return floats, nil
+}
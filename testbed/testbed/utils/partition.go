@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/testground/sdk-go/network"
+	"github.com/testground/sdk-go/ptypes"
+)
+
+// Partition cuts the links between a set of nodes and the rest of the nodes
+// at some point of a run, and heals them later. For example:
+//
+//	[{"at_ms": 2000, "heal_ms": 8000, "nodes": ["seed:0", "passive"]}]
+type Partition struct {
+	// AtMS is the time of the partition since the start of the transfer.
+	AtMS int64 `json:"at_ms"`
+	// HealMS is the time of the healing since the start of the transfer.
+	// Partitions without it are healed at the end of the run.
+	HealMS int64 `json:"heal_ms"`
+	// Nodes on one side of the partition, as node types ("seed"), node
+	// types and indices ("seed:0"), also with their group ("group:seed:0"),
+	// or sequence numbers ("7").
+	Nodes []string `json:"nodes"`
+}
+
+// ParsePartitions parses a JSON list of partitions.
+func ParsePartitions(value string) ([]Partition, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var partitions []Partition
+	if err := json.Unmarshal([]byte(value), &partitions); err != nil {
+		return nil, fmt.Errorf("Could not parse partitions: %w", err)
+	}
+	for i, p := range partitions {
+		if p.AtMS < 0 || (p.HealMS != 0 && p.HealMS <= p.AtMS) {
+			return nil, fmt.Errorf("Invalid partition %d: it must heal after %dms", i, p.AtMS)
+		}
+		if len(p.Nodes) == 0 {
+			return nil, fmt.Errorf("Invalid partition %d: no nodes", i)
+		}
+		for _, n := range p.Nodes {
+			if _, err := matchNode(PeerInfo{}, n); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return partitions, nil
+}
+
+// Contains returns whether the node is on the partitioned side.
+func (p Partition) Contains(inf PeerInfo) bool {
+	for _, n := range p.Nodes {
+		// Selectors are validated when parsed.
+		if ok, _ := matchNode(inf, n); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns a copy of the config where the links to the peers on the other
+// side of the partition drop all traffic. Partitioned nodes also deny the
+// routing of traffic outside the data network.
+func (p Partition) Apply(cfg *network.Config, self PeerInfo, peers []PeerInfo) (*network.Config, error) {
+	next := *cfg
+	next.Rules = append([]network.LinkRule(nil), cfg.Rules...)
+	inside := p.Contains(self)
+	if inside {
+		next.RoutingPolicy = network.DenyAll
+	}
+	for _, peer := range peers {
+		if peer.Addr.ID == self.Addr.ID || p.Contains(peer) == inside {
+			continue
+		}
+		ip, err := peerIP(peer.Addr)
+		if err != nil {
+			return nil, err
+		}
+		found := false
+		for i := range next.Rules {
+			if next.Rules[i].Subnet.IP.Equal(ip) {
+				next.Rules[i].Filter = network.Drop
+				found = true
+			}
+		}
+		if !found {
+			rule := network.LinkRule{
+				LinkShape: next.Default,
+				Subnet:    ptypes.IPNet{IPNet: net.IPNet{IP: ip, Mask: net.CIDRMask(32, 32)}},
+			}
+			rule.Filter = network.Drop
+			next.Rules = append(next.Rules, rule)
+		}
+	}
+	return &next, nil
+}
+
+// matchNode returns whether the node matches the selector. See Partition.Nodes
+// for the format of the selector.
+func matchNode(inf PeerInfo, node string) (bool, error) {
+	parts := strings.Split(node, ":")
+	switch len(parts) {
+	case 1:
+		if seq, err := strconv.ParseInt(parts[0], 10, 64); err == nil {
+			return inf.Seq == seq, nil
+		}
+		tp, ok := parseNodeType(parts[0])
+		if !ok {
+			return false, fmt.Errorf("Invalid node %q", node)
+		}
+		return inf.Nodetp == tp, nil
+	case 2, 3:
+		group := ""
+		if len(parts) == 3 {
+			group, parts = parts[0], parts[1:]
+		}
+		tp, ok := parseNodeType(parts[0])
+		if !ok {
+			return false, fmt.Errorf("Invalid node %q: unknown node type %q", node, parts[0])
+		}
+		tpindex, err := strconv.Atoi(parts[1])
+		if err != nil {
+			return false, fmt.Errorf("Invalid node %q: %w", node, err)
+		}
+		return inf.Nodetp == tp && inf.Tpindex == tpindex && (group == "" || inf.Group == group), nil
+	default:
+		return false, fmt.Errorf("Invalid node %q, expected <node type>, <seq>, <node type>:<index> or <group>:<node type>:<index>", node)
+	}
+}
+
+// parseNodeType returns the node type with the name, ignoring case.
+func parseNodeType(name string) (NodeType, bool) {
+	for _, tp := range []NodeType{Seed, Leech, Passive} {
+		if strings.EqualFold(tp.String(), name) {
+			return tp, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,48 @@
+package utils
+
+import "testing"
+
+func TestParsePartitions(t *testing.T) {
+	cases := []struct {
+		value   string
+		invalid bool
+	}{
+		{value: ``},
+		{value: `[{"at_ms": 2000, "heal_ms": 8000, "nodes": ["seed:0", "passive", "7", "nodes:leech:1"]}]`},
+		{value: `[{"at_ms": 2000, "nodes": ["Seed"]}]`},
+		{value: `[{"at_ms": 2000, "heal_ms": 1000, "nodes": ["seed"]}]`, invalid: true},
+		{value: `[{"at_ms": 2000, "nodes": []}]`, invalid: true},
+		{value: `[{"at_ms": 2000, "nodes": ["seeds"]}]`, invalid: true},
+		{value: `[{"at_ms": 2000, "nodes": ["seeds:0"]}]`, invalid: true},
+		{value: `[{"at_ms": 2000, "nodes": ["nodes:leach:1"]}]`, invalid: true},
+		{value: `[{"at_ms": 2000, "nodes": ["seed:a"]}]`, invalid: true},
+	}
+	for _, tt := range cases {
+		_, err := ParsePartitions(tt.value)
+		if tt.invalid && err == nil {
+			t.Errorf("ParsePartitions(%s): expected an error", tt.value)
+		} else if !tt.invalid && err != nil {
+			t.Errorf("ParsePartitions(%s): %v", tt.value, err)
+		}
+	}
+}
+
+func TestPartitionContains(t *testing.T) {
+	p := Partition{Nodes: []string{"seed:1", "g:leech:0", "passive", "7"}}
+	cases := []struct {
+		inf      PeerInfo
+		expected bool
+	}{
+		{PeerInfo{Nodetp: Seed, Tpindex: 1}, true},
+		{PeerInfo{Nodetp: Seed, Tpindex: 0}, false},
+		{PeerInfo{Nodetp: Leech, Tpindex: 0, Group: "g"}, true},
+		{PeerInfo{Nodetp: Leech, Tpindex: 0, Group: "h"}, false},
+		{PeerInfo{Nodetp: Passive, Tpindex: 3}, true},
+		{PeerInfo{Nodetp: Leech, Tpindex: 2, Seq: 7}, true},
+	}
+	for _, tt := range cases {
+		if got := p.Contains(tt.inf); got != tt.expected {
+			t.Errorf("Contains(%+v) = %t, expected %t", tt.inf, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"sync"
+
+	blocks "github.com/ipfs/go-block-format"
+	"github.com/ipfs/go-cid"
+	blockstore "github.com/ipfs/go-ipfs-blockstore"
+)
+
+// BlockHook is called every time a node receives a block while fetching.
+// Nodes that don't exchange blocks call it with cid.Undef for every chunk
+// of data read.
+type BlockHook func(c cid.Cid, size int)
+
+// blockHook holds the hook set in a node, if any.
+type blockHook struct {
+	lk sync.RWMutex
+	fn BlockHook
+}
+
+func (h *blockHook) set(fn BlockHook) {
+	h.lk.Lock()
+	h.fn = fn
+	h.lk.Unlock()
+}
+
+func (h *blockHook) notify(c cid.Cid, size int) {
+	h.lk.RLock()
+	defer h.lk.RUnlock()
+	if h.fn != nil {
+		h.fn(c, size)
+	}
+}
+
+// notifyBlockstore notifies every block put in the blockstore, which is
+// where exchanges store the blocks they receive.
+type notifyBlockstore struct {
+	blockstore.Blockstore
+	hook *blockHook
+}
+
+func (bs *notifyBlockstore) Put(b blocks.Block) error {
+	if err := bs.Blockstore.Put(b); err != nil {
+		return err
+	}
+	bs.hook.notify(b.Cid(), len(b.RawData()))
+	return nil
+}
+
+func (bs *notifyBlockstore) PutMany(bls []blocks.Block) error {
+	if err := bs.Blockstore.PutMany(bls); err != nil {
+		return err
+	}
+	for _, b := range bls {
+		bs.hook.notify(b.Cid(), len(b.RawData()))
+	}
+	return nil
+}
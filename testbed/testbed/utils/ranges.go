@@ -0,0 +1,76 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// RangeFetcher writes length bytes of the content starting at offset,
+// fetched from the source with the given index, to w.
+type RangeFetcher func(ctx context.Context, source int, offset int64, length int64, w io.Writer) error
+
+// FetchRanges splits size bytes in one range per source and fetches all the
+// ranges in parallel into a temporary file. A range that fails is retried on
+// the next source. It returns the path of the file.
+func FetchRanges(ctx context.Context, size int64, sources int, fetch RangeFetcher) (string, error) {
+	if sources == 0 {
+		return "", fmt.Errorf("no sources to fetch from")
+	}
+	tf, err := ioutil.TempFile("", "fetch-")
+	if err != nil {
+		return "", err
+	}
+	defer tf.Close()
+
+	rangeSize := size / int64(sources)
+	g, gctx := errgroup.WithContext(ctx)
+	for i := 0; i < sources; i++ {
+		i := i
+		offset := int64(i) * rangeSize
+		length := rangeSize
+		if i == sources-1 {
+			length = size - offset
+		}
+		if length == 0 {
+			continue
+		}
+		g.Go(func() error {
+			var err error
+			for attempt := 0; attempt < sources; attempt++ {
+				source := (i + attempt) % sources
+				w := &offsetWriter{f: tf, offset: offset}
+				if err = fetch(gctx, source, offset, length, w); err == nil {
+					if w.offset-offset != length {
+						err = fmt.Errorf("expected %d bytes from source %d, got %d", length, source, w.offset-offset)
+						continue
+					}
+					return nil
+				}
+				log.Debugf("failed to fetch range %d-%d from source %d: %v", offset, offset+length, source, err)
+			}
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		os.Remove(tf.Name())
+		return "", err
+	}
+	return tf.Name(), nil
+}
+
+// offsetWriter writes sequentially to a file starting at an offset.
+type offsetWriter struct {
+	f      *os.File
+	offset int64
+}
+
+func (w *offsetWriter) Write(p []byte) (int, error) {
+	n, err := w.f.WriteAt(p, w.offset)
+	w.offset += int64(n)
+	return n, err
+}
@@ -2,45 +2,58 @@ package utils
 
 import (
 	"context"
+	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
+	"math"
+	"sync/atomic"
 
 	"github.com/ipfs/go-cid"
 	files "github.com/ipfs/go-ipfs-files"
 	ipld "github.com/ipfs/go-ipld-format"
 	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/metrics"
 	"github.com/libp2p/go-libp2p-core/network"
 	"github.com/libp2p/go-libp2p-core/peer"
 	"github.com/libp2p/go-libp2p-core/protocol"
 )
 
 type RawLibp2pNode struct {
-	h host.Host
+	h             host.Host
+	parallelFetch bool
+	store         *fileStore
+	stats         streamStats
+	hostStats     *hostStats
 }
 
-func CreateRawLibp2pNode(ctx context.Context, h host.Host, nodeTP NodeType) (*RawLibp2pNode, error) {
+// CreateRawLibp2pNode creates a raw libp2p node. The bandwidth counter must be
+// the one attached to the host, it is used to report the traffic of the node.
+func CreateRawLibp2pNode(ctx context.Context, h host.Host, bwc *metrics.BandwidthCounter, nodeTP NodeType, parallelFetch bool) (*RawLibp2pNode, error) {
 	return &RawLibp2pNode{
-		h: h,
+		h:             h,
+		parallelFetch: parallelFetch,
+		store:         newFileStore(),
+		hostStats:     newHostStats(h, bwc),
 	}, nil
 }
 
-func (r *RawLibp2pNode) Add(ctx context.Context, file files.Node) (cid.Cid, error) {
-	f := files.ToFile(file)
-	if f == nil {
-		return cid.Undef, errors.New("node is NOT a File")
-	}
+// Requests are the offset and length of the range requested (8 bytes each).
+// Responses start with the total size of the file (8 bytes) followed by the
+// requested range. A request with length 0 only gets the size.
+const rawRangeHeaderLen = 16
 
-	// associate a random CID with the file here as we don't really care about CIDs for the Libp2p transfer
-	c, err := randCid()
+func (r *RawLibp2pNode) Add(ctx context.Context, file files.Node) (cid.Cid, error) {
+	c, err := r.store.add(file)
 	if err != nil {
 		return cid.Undef, err
 	}
 
 	// set up handler to send file
 	r.h.SetStreamHandler(protocol.ID(c.String()), func(s network.Stream) {
-		buf := make([]byte, network.MessageSizeMax)
-		if _, err := io.CopyBuffer(s, f, buf); err != nil {
+		if err := r.serveRange(s, c); err != nil {
 			s.Reset()
+			return
 		}
 		s.Close()
 	})
@@ -48,41 +61,138 @@ func (r *RawLibp2pNode) Add(ctx context.Context, file files.Node) (cid.Cid, erro
 	return c, nil
 }
 
-func (r *RawLibp2pNode) Fetch(ctx context.Context, cid cid.Cid, peers []PeerInfo) (files.Node, error) {
-	seedCount := 0
-	var seed peer.ID
+func (r *RawLibp2pNode) serveRange(s network.Stream, c cid.Cid) error {
+	atomic.AddUint64(&r.stats.reqsRcvd, 1)
+	req := make([]byte, rawRangeHeaderLen)
+	if _, err := io.ReadFull(s, req); err != nil {
+		return err
+	}
+	offset := int64(binary.BigEndian.Uint64(req[:8]))
+	length := binary.BigEndian.Uint64(req[8:])
 
-	for _, p := range peers {
-		if p.Nodetp == Seed {
-			seedCount++
-			seed = p.Addr.ID
-		}
+	f, err := r.store.open(c)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := st.Size()
+	if offset > size {
+		return fmt.Errorf("offset %d out of range", offset)
 	}
-	if seedCount != 1 {
-		return nil, errors.New("libp2p should ONLY have one seed")
+	if remaining := uint64(size - offset); length > remaining {
+		length = remaining
 	}
 
-	s, err := r.h.NewStream(ctx, seed, protocol.ID(cid.String()))
+	header := make([]byte, 8)
+	binary.BigEndian.PutUint64(header, uint64(size))
+	if _, err := s.Write(header); err != nil {
+		return err
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, network.MessageSizeMax)
+	_, err = io.CopyBuffer(&countingWriter{s, &r.stats}, io.LimitReader(f, int64(length)), buf)
+	return err
+}
+
+// requestRange opens a stream to the seed and requests a range of the file.
+// It returns the stream, positioned at the start of the range, and the total
+// size of the file.
+func (r *RawLibp2pNode) requestRange(ctx context.Context, seed peer.ID, c cid.Cid, offset int64, length uint64) (network.Stream, int64, error) {
+	atomic.AddUint64(&r.stats.reqsSent, 1)
+	s, err := r.h.NewStream(ctx, seed, protocol.ID(c.String()))
+	if err != nil {
+		return nil, 0, err
+	}
+	req := make([]byte, rawRangeHeaderLen)
+	binary.BigEndian.PutUint64(req[:8], uint64(offset))
+	binary.BigEndian.PutUint64(req[8:], length)
+	if _, err := s.Write(req); err != nil {
+		s.Reset()
+		return nil, 0, err
+	}
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(s, header); err != nil {
+		s.Reset()
+		return nil, 0, err
+	}
+	return s, int64(binary.BigEndian.Uint64(header)), nil
+}
+
+// Fetch gets the file from the seed assigned to this leech. If parallel fetch
+// is enabled, the file is split into byte ranges fetched in parallel from all seeds.
+func (r *RawLibp2pNode) Fetch(ctx context.Context, c cid.Cid, peers []PeerInfo) (files.Node, error) {
+	seeds := SeedsFor(r.h.ID(), peers)
+	if len(seeds) == 0 {
+		return nil, errors.New("no seed found")
+	}
+	r.stats.startFetch()
+
+	var err error
+	if !r.parallelFetch {
+		for _, seed := range seeds {
+			var s network.Stream
+			var size int64
+			s, size, err = r.requestRange(ctx, seed.Addr.ID, c, 0, math.MaxUint64)
+			if err == nil {
+				// The stream is closed once the file is fully read or closed.
+				return files.NewReaderFile(&countingReader{&sizedReader{s: s, remaining: size}, &r.stats}), nil
+			}
+		}
+		return nil, err
+	}
+
+	var size int64
+	for _, seed := range seeds {
+		var s network.Stream
+		s, size, err = r.requestRange(ctx, seed.Addr.ID, c, 0, 0)
+		if err == nil {
+			s.Close()
+			break
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
-	return files.NewReaderFile(s), nil
+	path, err := FetchRanges(ctx, size, len(seeds), func(ctx context.Context, source int, offset int64, length int64, w io.Writer) error {
+		s, _, err := r.requestRange(ctx, seeds[source].Addr.ID, c, offset, uint64(length))
+		if err != nil {
+			return err
+		}
+		sr := &sizedReader{s: s, remaining: length}
+		defer sr.Close()
+		_, err = io.Copy(w, &countingReader{sr, &r.stats})
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	r.store.addFetched(path)
+	return getUnixfsNode(path)
 }
 
 func (r *RawLibp2pNode) Host() host.Host {
 	return r.h
 }
 
-// NOOP FOR now,
-// #TODO Fix
+// EmitMetrics records the traffic of the host and the requests and fetch
+// timings of the node.
 func (r *RawLibp2pNode) EmitMetrics(recorder MetricsRecorder) error {
+	r.hostStats.emit(recorder)
+	r.stats.emitRequests(recorder)
 	return nil
 }
 
-// NO-OP
+// ClearDatastore removes the served file in seeds and the fetched files in leeches.
 func (r *RawLibp2pNode) ClearDatastore(ctx context.Context, rootCid cid.Cid) error {
-	return nil
+	r.h.RemoveStreamHandler(protocol.ID(rootCid.String()))
+	return r.store.clear(rootCid)
 }
 
 // NO-OP
@@ -90,7 +200,70 @@ func (r *RawLibp2pNode) DAGService() ipld.DAGService {
 	return nil
 }
 
-// NO-OP
+func (r *RawLibp2pNode) SetBlockHook(hook BlockHook) {
+	r.stats.hook.set(hook)
+}
+
+func (r *RawLibp2pNode) Progress() Progress {
+	return r.stats.progress()
+}
+
 func (r *RawLibp2pNode) EmitKeepAlive(recorder MessageRecorder) error {
+	r.hostStats.emitKeepAlive(recorder)
 	return nil
 }
+
+// sizedReader reads a range from a stream. It fails with
+// io.ErrUnexpectedEOF if the stream ends before the expected number of bytes
+// is read, and closes the stream once the range is fully read (or resets it
+// on errors), so that streams don't outlive the fetch even if the reader is
+// never closed.
+type sizedReader struct {
+	s         network.Stream
+	remaining int64
+	done      bool
+}
+
+func (r *sizedReader) Read(p []byte) (int, error) {
+	if r.remaining <= 0 {
+		r.Close()
+		return 0, io.EOF
+	}
+	if int64(len(p)) > r.remaining {
+		p = p[:r.remaining]
+	}
+	n, err := r.s.Read(p)
+	r.remaining -= int64(n)
+	switch {
+	case r.remaining <= 0:
+		r.Close()
+	case err == io.EOF:
+		err = io.ErrUnexpectedEOF
+		r.reset()
+	case err != nil:
+		r.reset()
+	}
+	return n, err
+}
+
+// Close closes the stream, or resets it if the range was not fully read.
+func (r *sizedReader) Close() error {
+	if r.done {
+		return nil
+	}
+	if r.remaining > 0 {
+		return r.reset()
+	}
+	r.done = true
+	return r.s.Close()
+}
+
+func (r *sizedReader) reset() error {
+	if r.done {
+		return nil
+	}
+	r.done = true
+	return r.s.Reset()
+}
+
+var _ Node = &RawLibp2pNode{}
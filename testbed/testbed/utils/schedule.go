@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/testground/sdk-go/network"
+)
+
+// NetworkStep changes the links of a node at some point of a run. Unset
+// fields keep their previous value. For example:
+//
+//	[{"at_ms": 2000, "latency_ms": 200}, {"at_ms": 5000, "bandwidth_mb": 1, "loss_pct": 5}]
+type NetworkStep struct {
+	// AtMS is the time of the change since the start of the transfer.
+	AtMS        int64    `json:"at_ms"`
+	LatencyMS   *int     `json:"latency_ms"`
+	BandwidthMB *int     `json:"bandwidth_mb"`
+	LossPct     *float64 `json:"loss_pct"`
+}
+
+// ParseNetworkSchedule parses a JSON list of network steps and sorts them by time.
+func ParseNetworkSchedule(value string) ([]NetworkStep, error) {
+	if strings.TrimSpace(value) == "" {
+		return nil, nil
+	}
+	var steps []NetworkStep
+	if err := json.Unmarshal([]byte(value), &steps); err != nil {
+		return nil, fmt.Errorf("Could not parse network schedule: %w", err)
+	}
+	for _, s := range steps {
+		if s.AtMS < 0 {
+			return nil, fmt.Errorf("Invalid network step at %dms", s.AtMS)
+		}
+		if s.LatencyMS != nil && *s.LatencyMS < 0 || s.BandwidthMB != nil && *s.BandwidthMB < 0 ||
+			s.LossPct != nil && (*s.LossPct < 0 || *s.LossPct > 100) {
+			return nil, fmt.Errorf("Invalid network step at %dms: %s", s.AtMS, s)
+		}
+	}
+	sort.SliceStable(steps, func(i, j int) bool { return steps[i].AtMS < steps[j].AtMS })
+	return steps, nil
+}
+
+func (s NetworkStep) String() string {
+	var changes []string
+	if s.LatencyMS != nil {
+		changes = append(changes, fmt.Sprintf("%dms latency", *s.LatencyMS))
+	}
+	if s.BandwidthMB != nil {
+		changes = append(changes, fmt.Sprintf("%dMB bandwidth", *s.BandwidthMB))
+	}
+	if s.LossPct != nil {
+		changes = append(changes, fmt.Sprintf("%g%% loss", *s.LossPct))
+	}
+	if len(changes) == 0 {
+		return "no changes"
+	}
+	return strings.Join(changes, ", ")
+}
+
+// Apply returns a copy of the config with the step applied to the default link
+// shape and to every rule, so the latency of the step replaces any pairwise
+// latency. Jitter keeps its percentage of the latency.
+func (s NetworkStep) Apply(cfg *network.Config) *network.Config {
+	next := *cfg
+	next.Default = s.applyShape(cfg.Default)
+	next.Rules = make([]network.LinkRule, len(cfg.Rules))
+	for i, r := range cfg.Rules {
+		next.Rules[i] = r
+		next.Rules[i].LinkShape = s.applyShape(r.LinkShape)
+	}
+	return &next
+}
+
+func (s NetworkStep) applyShape(shape network.LinkShape) network.LinkShape {
+	if s.LatencyMS != nil {
+		latency := time.Duration(*s.LatencyMS) * time.Millisecond
+		if shape.Latency > 0 {
+			shape.Jitter = time.Duration(float64(shape.Jitter) * float64(latency) / float64(shape.Latency))
+		}
+		shape.Latency = latency
+	}
+	if s.BandwidthMB != nil {
+		shape.Bandwidth = uint64(*s.BandwidthMB) * 1024 * 1024
+	}
+	if s.LossPct != nil {
+		shape.Loss = float32(*s.LossPct)
+	}
+	return shape
+}
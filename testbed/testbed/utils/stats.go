@@ -0,0 +1,162 @@
+package utils
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ipfs/go-cid"
+	"github.com/libp2p/go-libp2p-core/host"
+	"github.com/libp2p/go-libp2p-core/metrics"
+	"github.com/libp2p/go-libp2p-core/network"
+)
+
+// streamStats counts the payload traffic and requests of the stream-based
+// nodes, and times the fetches of leeches.
+type streamStats struct {
+	dataSent uint64
+	dataRcvd uint64
+	reqsSent uint64
+	reqsRcvd uint64
+
+	lk         sync.Mutex
+	fetchStart time.Time
+	firstByte  time.Time
+	lastByte   time.Time
+	fetchRcvd  int64
+
+	hook blockHook
+}
+
+// startFetch starts timing a new fetch.
+func (s *streamStats) startFetch() {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	s.fetchStart = time.Now()
+	s.firstByte = time.Time{}
+	s.lastByte = time.Time{}
+	s.fetchRcvd = 0
+}
+
+func (s *streamStats) received(n int) {
+	if n == 0 {
+		return
+	}
+	atomic.AddUint64(&s.dataRcvd, uint64(n))
+	s.hook.notify(cid.Undef, n)
+
+	now := time.Now()
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.firstByte.IsZero() {
+		s.firstByte = now
+	}
+	s.lastByte = now
+	s.fetchRcvd += int64(n)
+}
+
+func (s *streamStats) sent(n int) {
+	atomic.AddUint64(&s.dataSent, uint64(n))
+}
+
+func (s *streamStats) progress() Progress {
+	return Progress{BytesRcvd: atomic.LoadUint64(&s.dataRcvd)}
+}
+
+// emit records the payload traffic and requests, and resets the counters for
+// the next run.
+func (s *streamStats) emit(recorder MetricsRecorder) {
+	recorder.Record("data_sent", float64(atomic.SwapUint64(&s.dataSent, 0)))
+	recorder.Record("data_rcvd", float64(atomic.SwapUint64(&s.dataRcvd, 0)))
+	s.emitRequests(recorder)
+}
+
+// emitRequests records the requests and, for leeches, the time to first byte
+// and the throughput of the last fetch. Request counters are reset for the
+// next run, like the counters of hostStats.
+func (s *streamStats) emitRequests(recorder MetricsRecorder) {
+	recorder.Record("reqs_sent", float64(atomic.SwapUint64(&s.reqsSent, 0)))
+	recorder.Record("reqs_rcvd", float64(atomic.SwapUint64(&s.reqsRcvd, 0)))
+
+	s.lk.Lock()
+	defer s.lk.Unlock()
+	if s.firstByte.IsZero() {
+		return
+	}
+	recorder.Record("time_to_first_byte", float64(s.firstByte.Sub(s.fetchStart)))
+	if elapsed := s.lastByte.Sub(s.fetchStart); elapsed > 0 {
+		// Throughput in bytes per second.
+		recorder.Record("throughput", float64(s.fetchRcvd)/elapsed.Seconds())
+	}
+}
+
+func (s *streamStats) emitKeepAlive(recorder MessageRecorder) {
+	recorder.RecordMessage("I am still alive! Total In: %d - TotalOut: %d",
+		atomic.LoadUint64(&s.dataRcvd),
+		atomic.LoadUint64(&s.dataSent))
+}
+
+// countingReader counts the bytes read from the underlying reader.
+type countingReader struct {
+	io.ReadCloser
+	stats *streamStats
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.stats.received(n)
+	return n, err
+}
+
+// countingWriter counts the bytes written to the underlying writer.
+type countingWriter struct {
+	io.Writer
+	stats *streamStats
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.Writer.Write(p)
+	w.stats.sent(n)
+	return n, err
+}
+
+// hostStats counts the traffic and streams of a libp2p host using the
+// bandwidth counter attached to it.
+type hostStats struct {
+	bwc        *metrics.BandwidthCounter
+	streamsIn  uint64
+	streamsOut uint64
+}
+
+func newHostStats(h host.Host, bwc *metrics.BandwidthCounter) *hostStats {
+	s := &hostStats{bwc: bwc}
+	h.Network().Notify(&network.NotifyBundle{
+		OpenedStreamF: func(_ network.Network, st network.Stream) {
+			if st.Stat().Direction == network.DirInbound {
+				atomic.AddUint64(&s.streamsIn, 1)
+			} else {
+				atomic.AddUint64(&s.streamsOut, 1)
+			}
+		},
+	})
+	return s
+}
+
+// emit records the host traffic and streams, and resets the counters for
+// the next run.
+func (s *hostStats) emit(recorder MetricsRecorder) {
+	bwTotal := s.bwc.GetBandwidthTotals()
+	recorder.Record("data_sent", float64(bwTotal.TotalOut))
+	recorder.Record("data_rcvd", float64(bwTotal.TotalIn))
+	recorder.Record("streams_in", float64(atomic.SwapUint64(&s.streamsIn, 0)))
+	recorder.Record("streams_out", float64(atomic.SwapUint64(&s.streamsOut, 0)))
+	s.bwc.Reset()
+}
+
+func (s *hostStats) emitKeepAlive(recorder MessageRecorder) {
+	bwTotal := s.bwc.GetBandwidthTotals()
+	recorder.RecordMessage("I am still alive! Total In: %d - TotalOut: %d",
+		bwTotal.TotalIn,
+		bwTotal.TotalOut)
+}
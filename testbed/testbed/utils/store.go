@@ -0,0 +1,117 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	mh "github.com/multiformats/go-multihash"
+)
+
+// fileStore keeps the files served by seeds of the stream-based nodes
+// (http, libp2pHTTP, rawLibp2p) in temporary files, so that every request
+// gets its own reader. It also tracks the files fetched by leeches.
+type fileStore struct {
+	lk sync.Mutex
+	// Files served by the seed, by CID.
+	served map[cid.Cid]string
+	// Temporary files fetched by the leech.
+	fetched []string
+}
+
+func newFileStore() *fileStore {
+	return &fileStore{served: make(map[cid.Cid]string)}
+}
+
+// add stores the file and associates a raw CID with the hash of its content,
+// so that every seed adding the same file gets the same CID. Directories
+// can't be served, as leeches fetch a single stream of bytes.
+func (s *fileStore) add(file files.Node) (cid.Cid, error) {
+	tf, err := ioutil.TempFile("", "served-")
+	if err != nil {
+		return cid.Undef, err
+	}
+	c, err := contentCid(tf, file)
+	if err != nil {
+		tf.Close()
+		os.Remove(tf.Name())
+		return cid.Undef, err
+	}
+	if err := tf.Close(); err != nil {
+		return cid.Undef, err
+	}
+
+	s.lk.Lock()
+	s.served[c] = tf.Name()
+	s.lk.Unlock()
+	return c, nil
+}
+
+// contentCid writes the content of the file to w and returns a raw CID with
+// the sha256 hash of the content.
+func contentCid(w io.Writer, file files.Node) (cid.Cid, error) {
+	hasher := sha256.New()
+	w = io.MultiWriter(w, hasher)
+
+	var err error
+	switch f := file.(type) {
+	case files.File:
+		_, err = io.Copy(w, f)
+	case files.Directory:
+		err = errors.New("directories can't be served by http, libp2pHTTP and rawLibp2p nodes")
+	default:
+		err = errors.New("node is NOT a File or Directory")
+	}
+	if err != nil {
+		return cid.Undef, err
+	}
+	digest, err := mh.Encode(hasher.Sum(nil), mh.SHA2_256)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return cid.NewCidV1(cid.Raw, digest), nil
+}
+
+// open returns a new reader for the file with the given CID.
+func (s *fileStore) open(c cid.Cid) (*os.File, error) {
+	s.lk.Lock()
+	path, ok := s.served[c]
+	s.lk.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("file %s not found", c)
+	}
+	return os.Open(path)
+}
+
+// addFetched tracks a temporary file fetched by a leech.
+func (s *fileStore) addFetched(path string) {
+	s.lk.Lock()
+	s.fetched = append(s.fetched, path)
+	s.lk.Unlock()
+}
+
+// clear removes the served file with the given CID and all fetched files.
+func (s *fileStore) clear(c cid.Cid) error {
+	s.lk.Lock()
+	defer s.lk.Unlock()
+
+	if path, ok := s.served[c]; ok {
+		delete(s.served, c)
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	for _, path := range s.fetched {
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+	}
+	s.fetched = nil
+	return nil
+}
@@ -0,0 +1,52 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestTCPServer(t *testing.T) {
+	f := &RandFile{size: testFileSize, seed: 1}
+	want, err := ioutil.ReadAll(SeededRandReader(testFileSize, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := SpawnTCPServer(context.Background(), "127.0.0.1", f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Every client gets the whole file.
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial("tcp", s.Addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		header := make([]byte, 10)
+		if _, err := io.ReadFull(conn, header); err != nil {
+			t.Fatal(err)
+		}
+		size, err := strconv.ParseInt(strings.Trim(string(header), ":"), 10, 64)
+		if err != nil {
+			t.Fatalf("invalid size header %q: %v", header, err)
+		}
+		if size != f.Size() {
+			t.Errorf("size header is %d, expected %d", size, f.Size())
+		}
+		got, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("received %d bytes that don't match the %d bytes of the file", len(got), len(want))
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/ipfs/go-cid"
+	files "github.com/ipfs/go-ipfs-files"
+	mdtest "github.com/ipfs/go-merkledag/test"
+)
+
+// VerifyFile checks that the file or directory fetched to path matches rootCid.
+// Nodes exchanging DAGs import the content again with the same settings in an
+// in-memory DAG to re-derive the root CID. Baseline nodes, which have no DAG,
+// hash the content as the seeds did when they added it.
+func VerifyFile(ctx context.Context, n Node, rootCid cid.Cid, path string, settings AddSettings) error {
+	f, err := getUnixfsNode(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var c cid.Cid
+	if n.DAGService() == nil {
+		c, err = contentCid(ioutil.Discard, f)
+	} else {
+		c, err = dagCid(ctx, f, settings)
+	}
+	if err != nil {
+		return err
+	}
+	if !c.Equals(rootCid) {
+		return fmt.Errorf("content mismatch: expected %s, got %s", rootCid, c)
+	}
+	return nil
+}
+
+// dagCid imports the file in an in-memory DAG and returns its root CID.
+func dagCid(ctx context.Context, f files.Node, settings AddSettings) (cid.Cid, error) {
+	adder, err := NewDAGAdder(ctx, mdtest.Mock(), settings)
+	if err != nil {
+		return cid.Undef, err
+	}
+	nd, err := adder.Add(f)
+	if err != nil {
+		return cid.Undef, err
+	}
+	return nd.Cid(), nil
+}